@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+)
+
+var errAgeNotInteger = errors.New("age must be a whole number, e.g. 20")
+
+// Age is a student's age in whole years. It decodes strictly: 20 and 20.0
+// are accepted, but 20.5 and "20" are rejected instead of being truncated
+// or coerced.
+type Age int
+
+func (a *Age) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return errAgeNotInteger
+	}
+	num, ok := v.(json.Number)
+	if !ok {
+		return errAgeNotInteger
+	}
+
+	if n, err := num.Int64(); err == nil {
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return errAgeNotInteger
+		}
+		*a = Age(n)
+		return nil
+	}
+
+	f, err := num.Float64()
+	if err != nil || f != math.Trunc(f) || f < math.MinInt32 || f > math.MaxInt32 {
+		return errAgeNotInteger
+	}
+	*a = Age(f)
+	return nil
+}
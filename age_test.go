@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestAgeUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Age
+		wantErr bool
+	}{
+		{in: `20`, want: 20},
+		{in: `20.0`, want: 20},
+		{in: `0`, want: 0},
+		{in: `-3`, want: -3},
+		{in: `null`, want: 0},
+		{in: `20.5`, wantErr: true},
+		{in: `"20"`, wantErr: true},
+		{in: `true`, wantErr: true},
+		{in: `1e20`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			var got Age
+			err := json.Unmarshal([]byte(tt.in), &got)
+			if tt.wantErr {
+				if !errors.Is(err, errAgeNotInteger) {
+					t.Fatalf("Unmarshal(%s) error = %v, want %v", tt.in, err, errAgeNotInteger)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal(%s) error = %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("Unmarshal(%s) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAgeInStudent(t *testing.T) {
+	var s Student
+	if err := json.Unmarshal([]byte(`{"name": "Ann", "age": 20.0}`), &s); err != nil {
+		t.Fatalf("Unmarshal error = %v", err)
+	}
+	if s.Age != 20 {
+		t.Errorf("Age = %d, want 20", s.Age)
+	}
+
+	if err := json.Unmarshal([]byte(`{"name": "Ann", "age": 20.5}`), &s); err == nil {
+		t.Error("Unmarshal of age 20.5 succeeded, want an error")
+	}
+}
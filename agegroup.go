@@ -0,0 +1,34 @@
+package main
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// ageBand is one AGE_GROUPS entry: students younger than Below get Label.
+// The last band of a list has no upper bound (Below is 0) and takes every
+// age above the others.
+type ageBand struct {
+	Label string
+	Below int64
+}
+
+// ageBands is an AGE_GROUPS list, ordered by increasing Below.
+type ageBands []ageBand
+
+// defaultAgeBands is the AGE_GROUPS default, "child:13,teen:18,adult".
+var defaultAgeBands = ageBands{{"child", 13}, {"teen", 18}, {"adult", 0}}
+
+// ageGroupExpr is the $switch expression labelling a student with its band,
+// for ?withGroup=true. Students whose age is missing or not a number get
+// null rather than the youngest band, which they would otherwise sort
+// into.
+func ageGroupExpr(bands ageBands) bson.M {
+	branches := bson.A{
+		bson.M{"case": bson.M{"$not": bson.A{bson.M{"$isNumber": "$age"}}}, "then": nil},
+	}
+	for _, b := range bands[:len(bands)-1] {
+		branches = append(branches, bson.M{"case": bson.M{"$lt": bson.A{"$age", b.Below}}, "then": b.Label})
+	}
+	return bson.M{"$switch": bson.M{
+		"branches": branches,
+		"default":  bands[len(bands)-1].Label,
+	}}
+}
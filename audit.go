@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// AuditEntry records a single mutation of a student document. Tenant is
+// empty without multi-tenancy.
+type AuditEntry struct {
+	Op        string      `json:"op"               bson:"op"`
+	Tenant    string      `json:"tenant,omitempty" bson:"tenant,omitempty"`
+	TargetID  interface{} `json:"target_id"        bson:"target_id"`
+	Changes   bson.M      `json:"changes"          bson:"changes,omitempty"`
+	Actor     string      `json:"actor,omitempty"  bson:"actor"`
+	IP        string      `json:"ip,omitempty"     bson:"ip"`
+	Timestamp time.Time   `json:"timestamp"        bson:"timestamp"`
+}
+
+// recordAudit writes an audit entry in the background. Audit writes are
+// best-effort: failures are logged and never affect the response.
+func recordAudit(c *gin.Context, op string, targetID interface{}, changes bson.M) {
+	coll := auditColl()
+	if coll == nil {
+		return
+	}
+
+	entry := AuditEntry{
+		Op:        op,
+		Tenant:    requestTenant(c),
+		TargetID:  targetID,
+		Changes:   changes,
+		Actor:     callerIdentity(c),
+		IP:        c.ClientIP(),
+		Timestamp: time.Now().UTC(),
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if _, err := coll.InsertOne(ctx, entry); err != nil {
+			log.Printf("Failed to write audit entry (%s %v): %v", op, targetID, err)
+		}
+	}()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hasAdminKey reports whether the request carries the admin API key.
+func hasAdminKey(c *gin.Context, apiKey string) bool {
+	if apiKey == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(apiKey)) == 1
+}
+
+// callerRole is the access level used for response field masking.
+// Anonymous callers get the restricted view.
+func callerRole(c *gin.Context) string {
+	if hasAdminKey(c, os.Getenv("ADMIN_API_KEY")) {
+		return "admin"
+	}
+	return "anonymous"
+}
+
+// editorHeader names the editor behind an admin request. The admin API key
+// is shared, so it can't tell two editors apart on its own.
+const editorHeader = "X-Editor"
+
+// callerEditor is the editor an admin request names in X-Editor, or "" when
+// it names none. The header is ignored without the admin API key, so it
+// can't be used to pose as an editor.
+func callerEditor(c *gin.Context) string {
+	if callerRole(c) != "admin" {
+		return ""
+	}
+	return strings.TrimSpace(c.GetHeader(editorHeader))
+}
+
+// callerIdentity names the caller for audit purposes: the editor, for admin
+// requests that name one, and otherwise the caller's role.
+func callerIdentity(c *gin.Context) string {
+	if editor := callerEditor(c); editor != "" {
+		return editor
+	}
+	return callerRole(c)
+}
+
+// authRequired protects a route with the admin API key.
+// Callers must send "Authorization: Bearer <ADMIN_API_KEY>".
+func authRequired() gin.HandlerFunc {
+	apiKey := os.Getenv("ADMIN_API_KEY")
+
+	return func(c *gin.Context) {
+		if apiKey == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Admin access is not configured"})
+			return
+		}
+
+		if !hasAdminKey(c, apiKey) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// bulkAgeHandler serves PATCH /students/bulk-age, setting the given age on
+// each listed student in one unordered bulk write. Every entry gets its own
+// result: "updated", "not_found", "locked" (HONOR_LOCKS, with the holder)
+// or "failed" with the reason, so one bad entry never blocks the rest.
+func bulkAgeHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		var req struct {
+			Updates []struct {
+				ID  string `json:"id"`
+				Age *Age   `json:"age"`
+			} `json:"updates" binding:"required,min=1"`
+		}
+		if err := bindJSON(c, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if int64(len(req.Updates)) > cfg.MaxBatchSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d updates per request", cfg.MaxBatchSize)})
+			return
+		}
+
+		now := time.Now().UTC()
+		results := make([]gin.H, len(req.Updates))
+		seen := map[string]bool{}
+		var models []mongo.WriteModel
+		var modelIdx []int
+		var ids bson.A
+		for i, u := range req.Updates {
+			id, err := parseStudentID(u.ID)
+			switch {
+			case err != nil:
+				results[i] = gin.H{"id": u.ID, "status": "failed", "error": "Invalid student ID"}
+				continue
+			case u.Age == nil:
+				results[i] = gin.H{"id": u.ID, "status": "failed", "error": "age is required"}
+				continue
+			case *u.Age < 0 || *u.Age > maxAge:
+				results[i] = gin.H{"id": u.ID, "status": "failed", "error": fmt.Sprintf("age must be between 0 and %d", maxAge)}
+				continue
+			case seen[idString(id)]:
+				results[i] = gin.H{"id": u.ID, "status": "failed", "error": "id appears more than once"}
+				continue
+			}
+			seen[idString(id)] = true
+
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(writable(c, bson.M{"_id": id})).
+				SetUpdate(patchPipeline(bson.M{"age": *u.Age}, nil, now)))
+			modelIdx = append(modelIdx, i)
+			ids = append(ids, id)
+		}
+
+		ctx, cancel := dbContext(c, 30*time.Second)
+		defer cancel()
+
+		writeFailed := map[int]string{}
+		found := map[string]bool{}
+		var locked map[string]bson.M
+		if len(models) > 0 {
+			var err error
+			locked, err = findLocked(ctx, c, coll, bson.M{"_id": bson.M{"$in": ids}})
+			if err != nil {
+				dbError(c, err, gin.H{"error": "Failed to check locks"})
+				return
+			}
+
+			start := time.Now()
+			err = retryWrite(ctx, c, "bulkWrite", func() error {
+				_, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+				return err
+			})
+			recordDBTime(c, "bulkWrite", "bulk age", start)
+			var bulkErr mongo.BulkWriteException
+			if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+				for _, we := range bulkErr.WriteErrors {
+					writeFailed[modelIdx[we.Index]] = we.Message
+				}
+			} else if err != nil {
+				dbError(c, err, gin.H{"error": "Failed to update documents"})
+				return
+			}
+
+			// The bulk result only has totals, so look up which ids exist
+			// to tell updated entries from unknown ones.
+			start = time.Now()
+			filter := bson.M{"_id": bson.M{"$in": ids}}
+			cursor, err := coll.Find(ctx, live(filter), options.Find().SetProjection(bson.M{"_id": 1}))
+			if err != nil {
+				dbError(c, err, gin.H{"error": "Failed to fetch documents"})
+				return
+			}
+			var existing []struct {
+				ID interface{} `bson:"_id"`
+			}
+			err = cursor.All(ctx, &existing)
+			recordDBTime(c, "find", filter, start)
+			if err != nil {
+				dbError(c, err, gin.H{"error": "Failed to decode documents"})
+				return
+			}
+			for _, e := range existing {
+				found[idString(e.ID)] = true
+			}
+		}
+
+		updated := 0
+		for k, i := range modelIdx {
+			u := req.Updates[i]
+			switch {
+			case writeFailed[i] != "":
+				results[i] = gin.H{"id": u.ID, "status": "failed", "error": writeFailed[i]}
+			case !found[idString(ids[k])]:
+				results[i] = gin.H{"id": u.ID, "status": "not_found"}
+			case locked[idString(ids[k])] != nil:
+				l := docLock(locked[idString(ids[k])])
+				results[i] = gin.H{"id": u.ID, "status": "locked", "lockedBy": l.LockedBy, "lockedUntil": l.LockedUntil}
+			default:
+				updated++
+				results[i] = gin.H{"id": u.ID, "status": "updated", "age": *u.Age}
+				recordAudit(c, "update", ids[k], bson.M{"age": *u.Age})
+			}
+		}
+		failed := len(req.Updates) - updated
+
+		status := http.StatusOK
+		if failed > 0 {
+			status = http.StatusMultiStatus
+		}
+		c.JSON(status, gin.H{"updated": updated, "failed": failed, "results": results})
+	}
+}
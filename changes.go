@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// changesHandler serves GET /students/changes?since=<RFC 3339> for delta
+// sync: every student created, updated, soft-deleted or removed by archive
+// or merge at or after since, oldest change first. Deleted and removed
+// students come back as just {_id, deleted: true, deleted_at} so the client
+// can drop them. Deletions are only remembered for SOFT_DELETE_RETENTION;
+// a client that last synced longer ago should re-fetch the full list.
+//
+// The response's "next" is the since to use for the following sync: the
+// server time the query started at, or, when the change list was cut at
+// MAX_EXPORT_PAGE_SIZE ("truncated": true), the time of the last change
+// returned. since is inclusive, so a change exactly at the cursor can be
+// returned twice; clients should apply changes idempotently. A truncated
+// response also gives "nextAfterId", to be sent as ?afterId= with that
+// since: the cursor is then the (change time, _id) pair of the last change,
+// so a run of changes sharing one timestamp is paged through rather than
+// returned again and again.
+func changesHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		raw := c.Query("since")
+		if raw == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since is required"})
+			return
+		}
+		since, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC 3339 timestamp"})
+			return
+		}
+
+		// Changes at since itself only count after afterId.
+		after := bson.M{"_changed_at": bson.M{"$gte": since}}
+		if raw, ok := c.GetQuery("afterId"); ok {
+			afterID, err := parseStudentID(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "afterId: " + err.Error()})
+				return
+			}
+			after = bson.M{"$or": bson.A{
+				bson.M{"_changed_at": bson.M{"$gt": since}},
+				bson.M{"_changed_at": since, "_id": bson.M{"$gt": afterID}},
+			}}
+		}
+
+		ctx, cancel := dbContext(c, 30*time.Second)
+		defer cancel()
+
+		// Taken before querying, so anything written while we read is
+		// picked up by the next sync.
+		serverTime := time.Now().UTC()
+		limit := cfg.MaxExportPageSize
+
+		pipeline := mongo.Pipeline{
+			{{Key: "$match", Value: bson.M{"$or": bson.A{
+				bson.M{"updated_at": bson.M{"$gte": since}},
+				bson.M{"created_at": bson.M{"$gte": since}},
+				bson.M{softDeletedKey: bson.M{"$gte": since}},
+			}}}},
+			{{Key: "$addFields", Value: bson.M{
+				"_changed_at": bson.M{"$max": bson.A{"$updated_at", "$created_at", "$" + softDeletedKey}},
+			}}},
+			tombstoneStage(coll, since),
+			{{Key: "$match", Value: after}},
+			{{Key: "$sort", Value: bson.D{{Key: "_changed_at", Value: 1}, {Key: "_id", Value: 1}}}},
+			{{Key: "$limit", Value: limit + 1}},
+		}
+
+		start := time.Now()
+		cursor, err := coll.Aggregate(ctx, pipeline)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch changes"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		docs := []bson.M{}
+		err = cursor.All(ctx, &docs)
+		recordDBTime(c, "aggregate", "changes since", start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to decode changes"})
+			return
+		}
+
+		truncated := int64(len(docs)) > limit
+		next, nextAfterID := interface{}(serverTime), interface{}(nil)
+		if truncated {
+			docs = docs[:limit]
+			last := docs[len(docs)-1]
+			next, nextAfterID = last["_changed_at"], idString(last["_id"])
+		}
+
+		changes := make([]bson.M, len(docs))
+		for i, doc := range docs {
+			if deletedAt, ok := doc[softDeletedKey]; ok {
+				changes[i] = bson.M{"_id": doc["_id"], "deleted": true, softDeletedKey: deletedAt}
+				continue
+			}
+			delete(doc, "_changed_at")
+			maskFields(c, doc)
+			changes[i] = doc
+		}
+		renderDocs(c, changes)
+
+		c.JSON(http.StatusOK, gin.H{
+			"since":       since,
+			"serverTime":  serverTime,
+			"next":        next,
+			"nextAfterId": nextAfterID,
+			"truncated":   truncated,
+			"count":       len(changes),
+			"changes":     changes,
+		})
+	}
+}
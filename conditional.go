@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mutatedAtKey is the field of a collection's counters document that
+// records when the collection was last written to.
+const mutatedAtKey = "mutated_at"
+
+// lastModified returns when coll last changed, or the zero time when it has
+// never been written to. That is the later of the mutation time touchCollection
+// keeps in the counters collection, which also covers hard deletes (archive,
+// merge, the purge), and the newest updated_at, which covers documents
+// written before mutations were tracked or from outside the API.
+func lastModified(ctx context.Context, coll *mongo.Collection) (time.Time, error) {
+	var counter struct {
+		MutatedAt time.Time `bson:"mutated_at"`
+	}
+	err := coll.Database().Collection(countersCollection).FindOne(ctx, bson.M{"_id": coll.Name()},
+		options.FindOne().SetProjection(bson.M{mutatedAtKey: 1}),
+	).Decode(&counter)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return time.Time{}, err
+	}
+
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: "updated_at", Value: -1}}).
+		SetProjection(bson.D{{Key: "updated_at", Value: 1}})
+
+	var doc struct {
+		UpdatedAt time.Time `bson:"updated_at"`
+	}
+	err = coll.FindOne(ctx, bson.D{{Key: "updated_at", Value: bson.D{{Key: "$exists", Value: true}}}}, opts).Decode(&doc)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return time.Time{}, err
+	}
+
+	if doc.UpdatedAt.After(counter.MutatedAt) {
+		return doc.UpdatedAt, nil
+	}
+	return counter.MutatedAt, nil
+}
+
+// touchCollection records now as coll's last mutation time in its counters
+// document, creating the document if needed. $max keeps the time from going
+// backwards when concurrent writers race.
+func touchCollection(ctx context.Context, coll *mongo.Collection) error {
+	_, err := coll.Database().Collection(countersCollection).UpdateOne(ctx,
+		bson.M{"_id": coll.Name()},
+		bson.M{"$max": bson.M{mutatedAtKey: time.Now().UTC()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// trackMutations touches the request's students collection after every
+// successful write, so conditional list requests see changes that leave no
+// updated_at behind. The touch happens before the response is sent: a
+// client that re-fetches as soon as its write returns never gets a stale
+// 304.
+func trackMutations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		w := &mutationWriter{ResponseWriter: c.Writer, c: c}
+		c.Writer = w
+		c.Next()
+		// Handlers that only set a status have written nothing yet.
+		w.touch()
+	}
+}
+
+// mutationWriter touches the collection just before the response headers
+// are sent, once the handler's writes are done.
+type mutationWriter struct {
+	gin.ResponseWriter
+	c    *gin.Context
+	done bool
+}
+
+func (w *mutationWriter) touch() {
+	if w.done {
+		return
+	}
+	w.done = true
+	if w.Status() >= http.StatusBadRequest {
+		return
+	}
+	coll := studentsColl(w.c)
+	ctx, cancel := dbContext(w.c, 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	err := touchCollection(ctx, coll)
+	recordDBTime(w.c, "updateOne", "mutated_at", start)
+	if err != nil {
+		warnf("request %s: failed to record mutation of %s: %v", requestID(w.c), coll.Name(), err)
+	}
+}
+
+func (w *mutationWriter) WriteHeaderNow() {
+	w.touch()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *mutationWriter) Write(data []byte) (int, error) {
+	w.touch()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *mutationWriter) WriteString(s string) (int, error) {
+	w.touch()
+	return w.ResponseWriter.WriteString(s)
+}
+
+// notModified sets Last-Modified and reports whether the request's
+// If-Modified-Since is at or after lastMod, in which case the caller should
+// answer 304. HTTP dates only carry whole seconds, so compare at that
+// precision.
+func notModified(c *gin.Context, lastMod time.Time) bool {
+	if lastMod.IsZero() {
+		return false
+	}
+	lastMod = lastMod.UTC().Truncate(time.Second)
+	c.Header("Last-Modified", lastMod.Format(http.TimeFormat))
+
+	ims := c.GetHeader("If-Modified-Since")
+	if ims == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !lastMod.After(since)
+}
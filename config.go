@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the tunables read from the environment at startup.
+type Config struct {
+	Env                string        // APP_ENV; "production" disables debug helpers
+	MaxPageSize        int64         // upper bound applied to ?limit on list endpoints
+	MaxExportPageSize  int64         // MAX_EXPORT_PAGE_SIZE; upper bound applied to ?limit on exports
+	MaxBatchSize       int64         // MAX_BATCH_SIZE; most documents accepted by one bulk request
+	ImportBatchSize    int64         // IMPORT_BATCH_SIZE; documents per InsertMany during streaming imports
+	SlowQueryThreshold time.Duration // SLOW_QUERY_MS; DB calls slower than this are logged
+	ResponseEnvelope   bool          // RESPONSE_ENVELOPE; wrap responses as {data, meta}
+	StreamMaxDuration  time.Duration // STREAM_MAX_DURATION; SSE connections are closed after this
+	StreamHeartbeat    time.Duration // STREAM_HEARTBEAT; interval between SSE keep-alive comments
+	WriteConcern       string        // WRITE_CONCERN; "majority" or a node count, empty for the default
+	RateLimitRPS       int64         // RATE_LIMIT_RPS; sustained requests per second per client IP
+	RateLimitBurst     int64         // RATE_LIMIT_BURST; requests a client IP may make at once
+	TrustedProxies     []string      // TRUSTED_PROXIES; proxy IPs/CIDRs whose X-Forwarded-For is believed, empty trusts none
+	ListExcludedFields []string      // LIST_EXCLUDE_FIELDS; heavy fields left out of list responses by default
+	HealthInterval     time.Duration // HEALTH_CHECK_INTERVAL; how often MongoDB is pinged in the background
+	MaxConcurrent      int64         // MAX_CONCURRENT_REQUESTS; in-flight requests allowed at once
+	ConcurrencyWait    time.Duration // CONCURRENCY_WAIT; how long a request may queue for a slot
+	CustomIDs          bool          // CUSTOM_IDS; let POST /students supply a string "id" used as _id
+	DefaultSort        string        // DEFAULT_SORT; sort spec applied when a list request has no ?sort
+	CollectionOpts     string        // CREATE_COLLECTION_OPTS; JSON options used to create the students collection
+	MaxBodyBytes       int64         // MAX_BODY_BYTES; largest JSON request body accepted
+	MaxJSONDepth       int64         // MAX_JSON_DEPTH; deepest object/array nesting accepted in a JSON body
+	StrictJSON         bool          // STRICT_JSON; reject unknown fields in JSON request bodies
+	MaxImportBytes     int64         // MAX_IMPORT_BYTES; largest body accepted by the streaming import endpoints
+	DeletedRetention   time.Duration // SOFT_DELETE_RETENTION; how long soft-deleted students are kept before purging
+	PurgeInterval      time.Duration // SOFT_DELETE_PURGE_INTERVAL; how often the purge job runs
+	RequestMaxSkew     time.Duration // REQUEST_MAX_SKEW; max age of a write request's timestamp, 0 disables the check
+	WriteRetries       int64         // WRITE_RETRIES; extra attempts for writes failing with a transient error
+	WriteRetryBackoff  time.Duration // WRITE_RETRY_BACKOFF; wait before the first retry, doubled for each next one
+	RouteTimeouts      routeTimeouts // ROUTE_TIMEOUTS; per-route DB timeouts, e.g. "GET /students/:id=2s,/students/export.csv=5m"
+	RequestTimeout     time.Duration // REQUEST_TIMEOUT; timeout for routes not in ROUTE_TIMEOUTS, 0 keeps each handler's own
+	Tenants            []string      // TENANTS; allowlisted tenant ids, each with its own collections; empty disables multi-tenancy
+	TenantHeader       string        // TENANT_HEADER; header carrying the tenant id, the Host subdomain is used without it
+	CancelOnDisconnect bool          // CANCEL_ON_DISCONNECT; cancel a request's DB calls when its client disconnects
+	TrailingSlash      string        // TRAILING_SLASH; "redirect", "match" or "strict" handling of /students/
+	CaseInsensitive    bool          // CASE_INSENSITIVE_ROUTES; redirect /Students to /students
+	SecurityHeaders    headerValues  // SECURITY_HEADERS; JSON object of response headers, "" drops a default
+	ForceHTTPS         bool          // FORCE_HTTPS; redirect requests the proxy saw as plain HTTP to HTTPS
+	JSONNaming         string        // JSON_NAMING; "snake" or "camel" keys for student fields in JSON responses
+	LockTTL            time.Duration // LOCK_TTL; how long POST /students/:id/lock holds a lock without ?ttl=
+	HonorLocks         bool          // HONOR_LOCKS; reject writes to a student someone else has locked
+	AgeGroups          ageBands      // AGE_GROUPS; ?withGroup=true bands as label:below pairs, e.g. "child:13,teen:18,adult"
+}
+
+var cfg Config
+
+func loadConfig() Config {
+	env := os.Getenv("APP_ENV")
+	if env == "" {
+		env = "development"
+	}
+
+	return Config{
+		Env:                env,
+		MaxPageSize:        envInt("MAX_PAGE_SIZE", 100),
+		MaxExportPageSize:  envInt("MAX_EXPORT_PAGE_SIZE", 10000),
+		MaxBatchSize:       envInt("MAX_BATCH_SIZE", 500),
+		ImportBatchSize:    envInt("IMPORT_BATCH_SIZE", 500),
+		SlowQueryThreshold: time.Duration(envInt("SLOW_QUERY_MS", 500)) * time.Millisecond,
+		ResponseEnvelope:   envBool("RESPONSE_ENVELOPE", false),
+		StreamMaxDuration:  envDuration("STREAM_MAX_DURATION", 30*time.Minute),
+		StreamHeartbeat:    envDuration("STREAM_HEARTBEAT", 15*time.Second),
+		WriteConcern:       os.Getenv("WRITE_CONCERN"),
+		RateLimitRPS:       envInt("RATE_LIMIT_RPS", 10),
+		RateLimitBurst:     envInt("RATE_LIMIT_BURST", 20),
+		TrustedProxies:     envList("TRUSTED_PROXIES", nil),
+		ListExcludedFields: envList("LIST_EXCLUDE_FIELDS", []string{"courses"}),
+		HealthInterval:     envDuration("HEALTH_CHECK_INTERVAL", 30*time.Second),
+		MaxConcurrent:      envInt("MAX_CONCURRENT_REQUESTS", 100),
+		ConcurrencyWait:    envDuration("CONCURRENCY_WAIT", 100*time.Millisecond),
+		CustomIDs:          envBool("CUSTOM_IDS", false),
+		DefaultSort:        envSort("DEFAULT_SORT", "_id"),
+		CollectionOpts:     os.Getenv("CREATE_COLLECTION_OPTS"),
+		MaxBodyBytes:       envInt("MAX_BODY_BYTES", 1<<20),
+		MaxJSONDepth:       envInt("MAX_JSON_DEPTH", 32),
+		StrictJSON:         envBool("STRICT_JSON", false),
+		MaxImportBytes:     envInt("MAX_IMPORT_BYTES", 100<<20),
+		DeletedRetention:   envDuration("SOFT_DELETE_RETENTION", 30*24*time.Hour),
+		PurgeInterval:      envDuration("SOFT_DELETE_PURGE_INTERVAL", time.Hour),
+		RequestMaxSkew:     envDuration("REQUEST_MAX_SKEW", 0),
+		WriteRetries:       envInt("WRITE_RETRIES", 2),
+		WriteRetryBackoff:  envDuration("WRITE_RETRY_BACKOFF", 100*time.Millisecond),
+		RouteTimeouts:      envTimeouts("ROUTE_TIMEOUTS"),
+		RequestTimeout:     envDuration("REQUEST_TIMEOUT", 0),
+		Tenants:            envList("TENANTS", nil),
+		TenantHeader:       envString("TENANT_HEADER", "X-Tenant-ID"),
+		CancelOnDisconnect: envBool("CANCEL_ON_DISCONNECT", true),
+		TrailingSlash:      envChoice("TRAILING_SLASH", trailingSlashRedirect, trailingSlashMatch, trailingSlashStrict),
+		CaseInsensitive:    envBool("CASE_INSENSITIVE_ROUTES", false),
+		SecurityHeaders:    envHeaders("SECURITY_HEADERS", defaultSecurityHeaders),
+		ForceHTTPS:         envBool("FORCE_HTTPS", false),
+		JSONNaming:         envChoice("JSON_NAMING", namingSnake, namingCamel),
+		LockTTL:            envDuration("LOCK_TTL", 5*time.Minute),
+		HonorLocks:         envBool("HONOR_LOCKS", false),
+		AgeGroups:          envAgeBands("AGE_GROUPS", defaultAgeBands),
+	}
+}
+
+// envInt reads a positive integer from the environment, falling back to def
+// when the variable is unset or invalid.
+func envInt(key string, def int64) int64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid %s=%q, using default %d", key, v, def)
+		return def
+	}
+	return n
+}
+
+// envString reads a string from the environment, falling back to def when
+// the variable is unset.
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envBool reads a boolean from the environment, falling back to def when the
+// variable is unset or invalid.
+func envBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using default %t", key, v, def)
+		return def
+	}
+	return b
+}
+
+// envDuration reads a positive Go duration (e.g. "30s", "5m") from the
+// environment, falling back to def when the variable is unset or invalid.
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("Invalid %s=%q, using default %s", key, v, def)
+		return def
+	}
+	return d
+}
+
+// envList reads a comma-separated list from the environment, falling back to
+// def when the variable is unset. Set it to "-" for an empty list.
+func envList(key string, def []string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" && item != "-" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// envSort reads a sort spec in the ?sort= syntax from the environment,
+// falling back to def when the variable is unset or names an unsortable field.
+func envSort(key, def string) string {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	if _, err := parseSort(v); err != nil {
+		log.Printf("Invalid %s=%q (%v), using default %s", key, v, err, def)
+		return def
+	}
+	return v
+}
+
+// envTimeouts reads a comma-separated list of route=duration pairs from the
+// environment. A route is a Gin pattern, optionally prefixed with a method
+// ("GET /students/:id=2s"). Malformed entries are logged and skipped.
+func envTimeouts(key string) routeTimeouts {
+	timeouts := routeTimeouts{}
+	for _, item := range envList(key, nil) {
+		i := strings.LastIndex(item, "=")
+		if i < 0 {
+			log.Printf("Invalid %s entry %q, expected route=duration", key, item)
+			continue
+		}
+		route := strings.Join(strings.Fields(item[:i]), " ")
+		d, err := time.ParseDuration(strings.TrimSpace(item[i+1:]))
+		if err != nil || d <= 0 || route == "" {
+			log.Printf("Invalid %s entry %q, expected route=duration", key, item)
+			continue
+		}
+		timeouts[route] = d
+	}
+	return timeouts
+}
+
+// envAgeBands reads a comma-separated list of label:below age bands from
+// the environment, youngest first, e.g. "child:13,teen:18,adult". Every band
+// but the last needs an upper bound greater than the one before it; the
+// last must have none. An invalid list is logged and def is used instead.
+func envAgeBands(key string, def ageBands) ageBands {
+	items := envList(key, nil)
+	if len(items) == 0 {
+		return def
+	}
+
+	var bands ageBands
+	for i, item := range items {
+		label, below, hasBound := strings.Cut(item, ":")
+		label = strings.TrimSpace(label)
+		last := i == len(items)-1
+		if label == "" || hasBound == last {
+			log.Printf("Invalid %s=%q, using the default age groups", key, os.Getenv(key))
+			return def
+		}
+		band := ageBand{Label: label}
+		if !last {
+			n, err := strconv.ParseInt(strings.TrimSpace(below), 10, 64)
+			if err != nil || n <= 0 || (i > 0 && n <= bands[i-1].Below) {
+				log.Printf("Invalid %s=%q, using the default age groups", key, os.Getenv(key))
+				return def
+			}
+			band.Below = n
+		}
+		bands = append(bands, band)
+	}
+	return bands
+}
+
+// envChoice reads one of a fixed set of values from the environment,
+// falling back to def when the variable is unset or not one of def and
+// others.
+func envChoice(key, def string, others ...string) string {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	if v != def && !slices.Contains(others, v) {
+		log.Printf("Invalid %s=%q, using default %s", key, v, def)
+		return def
+	}
+	return v
+}
+
+// envHeaders reads a JSON object of header names to values from the
+// environment and merges it over def. An empty value removes that header
+// from def. Invalid JSON is logged and def is used as is.
+func envHeaders(key string, def headerValues) headerValues {
+	headers := headerValues{}
+	for name, value := range def {
+		headers[name] = value
+	}
+	v := os.Getenv(key)
+	if v == "" {
+		return headers
+	}
+
+	var overrides map[string]string
+	if err := json.Unmarshal([]byte(v), &overrides); err != nil {
+		log.Printf("Invalid %s, using defaults: %v", key, err)
+		return headers
+	}
+	for name, value := range overrides {
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if value == "" {
+			delete(headers, name)
+		} else {
+			headers[name] = value
+		}
+	}
+	return headers
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+var defaultCORSOrigins = []string{"http://localhost:5173", "https://your-render-service.onrender.com"}
+
+// corsOrigins reads CORS_ALLOWED_ORIGINS as a comma-separated list.
+// Entries that are not "*" or a bare http(s) origin are logged and
+// skipped; when none are left, the defaults apply.
+func corsOrigins() []string {
+	v := os.Getenv("CORS_ALLOWED_ORIGINS")
+	if v == "" {
+		return defaultCORSOrigins
+	}
+
+	var origins []string
+	for _, o := range strings.Split(v, ",") {
+		if o = strings.TrimSpace(o); o == "" {
+			continue
+		}
+		if !validCORSOrigin(o) {
+			warnf("invalid CORS origin %q, expected e.g. https://example.com; skipping", o)
+			continue
+		}
+		origins = append(origins, strings.TrimSuffix(o, "/"))
+	}
+	if len(origins) == 0 {
+		warnf("CORS_ALLOWED_ORIGINS=%q has no valid origins, using the defaults", v)
+		return defaultCORSOrigins
+	}
+	return origins
+}
+
+// validCORSOrigin reports whether o is "*" or an origin as browsers send
+// it: an http or https scheme and a host, with no path, query or fragment.
+func validCORSOrigin(o string) bool {
+	if o == "*" {
+		return true
+	}
+	u, err := url.Parse(o)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.User == nil && (u.Path == "" || u.Path == "/") && u.RawQuery == "" && u.Fragment == ""
+}
+
+// corsAllowCredentials decides AllowCredentials for the given origins.
+// Browsers reject credentialed responses with "Access-Control-Allow-Origin: *",
+// so credentials default to off when the origins contain "*". An explicit
+// CORS_ALLOW_CREDENTIALS=true in that case is invalid and is overridden.
+func corsAllowCredentials(origins []string) bool {
+	wildcard := slices.Contains(origins, "*")
+
+	v := os.Getenv("CORS_ALLOW_CREDENTIALS")
+	if v == "" {
+		return !wildcard
+	}
+
+	allow, err := strconv.ParseBool(v)
+	if err != nil {
+		warnf("invalid CORS_ALLOW_CREDENTIALS=%q, ignoring", v)
+		return !wildcard
+	}
+	if allow && wildcard {
+		warnf("CORS_ALLOW_CREDENTIALS=true cannot be combined with a \"*\" origin; disabling credentials")
+		return false
+	}
+	return allow
+}
+
+// newCORS builds the CORS middleware for config, returning the error
+// cors.New would panic with instead.
+func newCORS(config cors.Config) (gin.HandlerFunc, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return cors.New(config), nil
+}
+
+func corsConfig() cors.Config {
+	origins := corsOrigins()
+
+	return cors.Config{
+		AllowOrigins:     origins,
+		AllowMethods:     []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "If-Modified-Since", "X-Debug-Timing", "X-Request-Timestamp", "X-Request-ID", editorHeader, cfg.TenantHeader},
+		ExposeHeaders:    []string{"X-Total-Count", "X-Limit", "X-Skip", "X-Sort", "Last-Modified", "Server-Timing", "X-Export-Range", "Location", "X-Request-ID"},
+		AllowCredentials: corsAllowCredentials(origins),
+	}
+}
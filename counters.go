@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// countersCollection holds one sequence document per students collection,
+// {_id: <collection name>, seq: <last number handed out>}, so tenants and
+// the default collection number their students independently.
+const countersCollection = "counters"
+
+// reserveStudentNumbers atomically claims n consecutive student numbers for
+// coll and returns the first. The counter document is created on first
+// use, so numbering starts at 1. Concurrent callers never get overlapping
+// ranges; a number is lost, leaving a gap, only when the insert it was
+// claimed for fails.
+func reserveStudentNumbers(ctx context.Context, coll *mongo.Collection, n int) (int64, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := coll.Database().Collection(countersCollection).FindOneAndUpdate(ctx,
+		bson.M{"_id": coll.Name()},
+		bson.M{"$inc": bson.M{"seq": int64(n)}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return 0, err
+	}
+	return counter.Seq - int64(n) + 1, nil
+}
+
+// numberDocs gives each of docs, insertDoc results not yet written, the
+// next student number of coll, in order.
+func numberDocs(ctx context.Context, coll *mongo.Collection, docs []interface{}) error {
+	first, err := reserveStudentNumbers(ctx, coll, len(docs))
+	if err != nil {
+		return err
+	}
+	for i := range docs {
+		docs[i] = append(docs[i].(bson.D), bson.E{Key: "student_number", Value: first + int64(i)})
+	}
+	return nil
+}
+
+// studentNumberHandler serves POST /students/:id/number, which gives an
+// existing student without a number, such as one stored before numbering
+// was added or one inserted by POST /students/upsert, the next one. A
+// student that already has a number keeps it, so the call is idempotent.
+func studentNumberHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+		id := studentID(c)
+
+		ctx, cancel := dbContext(c, 5*time.Second)
+		defer cancel()
+
+		var student struct {
+			StudentNumber int64 `bson:"student_number"`
+		}
+		start := time.Now()
+		err := coll.FindOne(ctx, live(bson.M{"_id": id}), options.FindOne().SetProjection(bson.M{"student_number": 1})).Decode(&student)
+		recordDBTime(c, "findOne", bson.M{"_id": id}, start)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+			return
+		}
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch document"})
+			return
+		}
+		if student.StudentNumber != 0 {
+			c.JSON(http.StatusOK, gin.H{"studentNumber": student.StudentNumber, "assigned": false})
+			return
+		}
+
+		start = time.Now()
+		number, err := reserveStudentNumbers(ctx, coll, 1)
+		recordDBTime(c, "findOneAndUpdate", "next student number", start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to assign student number"})
+			return
+		}
+
+		// Only a student still without a number takes it; a concurrent call
+		// may have numbered it since the read above.
+		start = time.Now()
+		result, err := coll.UpdateOne(ctx,
+			live(bson.M{"_id": id, "student_number": bson.M{"$exists": false}}),
+			bson.M{"$set": bson.M{"student_number": number, "updated_at": time.Now().UTC()}},
+		)
+		recordDBTime(c, "updateOne", bson.M{"_id": id}, start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to assign student number"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			err := coll.FindOne(ctx, live(bson.M{"_id": id}), options.FindOne().SetProjection(bson.M{"student_number": 1})).Decode(&student)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+				return
+			}
+			if err != nil {
+				dbError(c, err, gin.H{"error": "Failed to fetch document"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"studentNumber": student.StudentNumber, "assigned": false})
+			return
+		}
+
+		recordAudit(c, "number", id, bson.M{"student_number": number})
+
+		c.JSON(http.StatusOK, gin.H{"studentNumber": number, "assigned": true})
+	}
+}
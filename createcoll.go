@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// collectionOpts is the JSON accepted by CREATE_COLLECTION_OPTS, e.g.
+// {"capped": true, "size": 1048576, "max": 10000}.
+type collectionOpts struct {
+	Capped *bool  `json:"capped"`
+	Size   *int64 `json:"size"` // bytes; required by the server when capped
+	Max    *int64 `json:"max"`  // documents; capped collections only
+}
+
+// parseCollectionOpts turns CREATE_COLLECTION_OPTS into driver options. An
+// empty string means "let the collection be created implicitly" and
+// returns nil.
+func parseCollectionOpts(v string) (*options.CreateCollectionOptions, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	var o collectionOpts
+	dec := json.NewDecoder(strings.NewReader(v))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&o); err != nil {
+		return nil, fmt.Errorf("invalid collection options %q: %v", v, err)
+	}
+
+	opts := options.CreateCollection()
+	if o.Capped != nil {
+		opts.SetCapped(*o.Capped)
+	}
+	if o.Size != nil {
+		opts.SetSizeInBytes(*o.Size)
+	}
+	if o.Max != nil {
+		opts.SetMaxDocuments(*o.Max)
+	}
+	return opts, nil
+}
+
+// ensureCollection creates the named collection with opts when it does not
+// exist yet. An existing collection is left alone, whatever its options.
+func ensureCollection(ctx context.Context, db *mongo.Database, name string, opts *options.CreateCollectionOptions) error {
+	if opts == nil {
+		return nil
+	}
+
+	names, err := db.ListCollectionNames(ctx, bson.M{"name": name})
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		return nil
+	}
+
+	err = db.CreateCollection(ctx, name, opts)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Name == "NamespaceExists" {
+		return nil // another instance created it first
+	}
+	return err
+}
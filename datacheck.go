@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// schemaRule is one check GET /admin/validate-data runs: the filter matches
+// the stored documents that break it.
+type schemaRule struct {
+	Name    string
+	Message string
+	Filter  bson.M
+}
+
+// schemaRules are the fields the current schema expects of every stored
+// student, mirroring checkStudentFields and prepareInsert. Documents
+// written by older versions, or directly to the database, may break them.
+var schemaRules = []schemaRule{
+	{
+		Name:    "name",
+		Message: "name is missing, blank or not a string",
+		Filter: bson.M{"$or": bson.A{
+			bson.M{"name": bson.M{"$not": bson.M{"$type": "string"}}},
+			bson.M{"name": bson.M{"$regex": `^\s*$`}},
+		}},
+	},
+	{
+		Name:    "age",
+		Message: fmt.Sprintf("age is missing, not a number or not between 0 and %d", maxAge),
+		Filter: bson.M{"$or": bson.A{
+			bson.M{"age": bson.M{"$not": bson.M{"$type": "number"}}},
+			bson.M{"age": bson.M{"$lt": 0}},
+			bson.M{"age": bson.M{"$gt": maxAge}},
+		}},
+	},
+	{
+		Name:    "created_at",
+		Message: "created_at is missing or not a date",
+		Filter:  bson.M{"created_at": bson.M{"$not": bson.M{"$type": "date"}}},
+	},
+	{
+		Name:    "updated_at",
+		Message: "updated_at is missing or not a date",
+		Filter:  bson.M{"updated_at": bson.M{"$not": bson.M{"$type": "date"}}},
+	},
+}
+
+// validateDataHandler serves GET /admin/validate-data, which reports the
+// stored documents of coll breaking each of schemaRules: how many, and the
+// _ids of up to ?limit (default 100, at most MAX_PAGE_SIZE) of them. A
+// document breaking several rules is listed under each.
+func validateDataHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		limit := int64(100)
+		if raw := c.Query("limit"); raw != "" {
+			var err error
+			if limit, err = intParam("limit", raw, 1, cfg.MaxPageSize); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		ctx, cancel := dbContext(c, 2*time.Minute)
+		defer cancel()
+
+		violations := []gin.H{}
+		var total int64
+		for _, rule := range schemaRules {
+			start := time.Now()
+			n, err := coll.CountDocuments(ctx, rule.Filter)
+			recordDBTime(c, "countDocuments", rule.Filter, start)
+			if err != nil {
+				dbError(c, err, gin.H{"error": "Failed to count documents"})
+				return
+			}
+			if n == 0 {
+				continue
+			}
+
+			start = time.Now()
+			cursor, err := coll.Find(ctx, rule.Filter, options.Find().
+				SetProjection(bson.M{"_id": 1}).
+				SetSort(bson.D{{Key: "_id", Value: 1}}).
+				SetLimit(limit))
+			if err != nil {
+				dbError(c, err, gin.H{"error": "Failed to fetch documents"})
+				return
+			}
+			var docs []bson.M
+			err = cursor.All(ctx, &docs)
+			recordDBTime(c, "find", rule.Filter, start)
+			if err != nil {
+				dbError(c, err, gin.H{"error": "Failed to decode documents"})
+				return
+			}
+
+			ids := make([]interface{}, len(docs))
+			for i, doc := range docs {
+				ids[i] = doc["_id"]
+			}
+			total += n
+			violations = append(violations, gin.H{
+				"rule":    rule.Name,
+				"message": rule.Message,
+				"count":   n,
+				"ids":     ids,
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{"valid": total == 0, "violations": violations})
+	}
+}
+
+// repair is one backfill POST /admin/repair applies: the pipeline update
+// is run on every document the filter matches.
+type repair struct {
+	Name   string
+	Filter bson.M
+	Update mongo.Pipeline
+}
+
+// objectIDTime is the creation time embedded in an ObjectID _id.
+var objectIDTime = bson.M{"$toDate": "$_id"}
+
+// repairs only ever set fields that are missing, so running them again
+// changes nothing. Name and age have no sensible default and are left for
+// a person to fix.
+var repairs = []repair{
+	{
+		// The ObjectID records when the document was inserted.
+		Name:   "created_at",
+		Filter: bson.M{"created_at": bson.M{"$not": bson.M{"$type": "date"}}, "_id": bson.M{"$type": "objectId"}},
+		Update: mongo.Pipeline{{{Key: "$set", Value: bson.M{"created_at": objectIDTime}}}},
+	},
+	{
+		// A document never updated was last changed when it was created.
+		// created_at is read from the _id as well when it is missing too,
+		// so this doesn't depend on running after the repair above.
+		Name: "updated_at",
+		Filter: bson.M{
+			"updated_at": bson.M{"$not": bson.M{"$type": "date"}},
+			"$or": bson.A{
+				bson.M{"created_at": bson.M{"$type": "date"}},
+				bson.M{"_id": bson.M{"$type": "objectId"}},
+			},
+		},
+		Update: mongo.Pipeline{{{Key: "$set", Value: bson.M{"updated_at": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{bson.M{"$type": "$created_at"}, "date"}},
+			"$created_at",
+			objectIDTime,
+		}}}}}},
+	},
+}
+
+// repairHandler serves POST /admin/repair, which backfills the fields of
+// coll's documents that repairs can derive, and reports how many documents
+// each repair changed. ?dryRun=true only counts the documents each repair
+// would change. Run GET /admin/validate-data afterwards for what is left.
+func repairHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+		dryRun := c.Query("dryRun") == "true"
+
+		ctx, cancel := dbContext(c, 5*time.Minute)
+		defer cancel()
+
+		results := []gin.H{}
+		counts := bson.M{}
+		for _, r := range repairs {
+			start := time.Now()
+			if dryRun {
+				n, err := coll.CountDocuments(ctx, r.Filter)
+				recordDBTime(c, "countDocuments", r.Filter, start)
+				if err != nil {
+					dbError(c, err, gin.H{"error": "Failed to count documents", "results": results})
+					return
+				}
+				results = append(results, gin.H{"repair": r.Name, "wouldRepair": n})
+				continue
+			}
+
+			result, err := coll.UpdateMany(ctx, r.Filter, r.Update)
+			recordDBTime(c, "updateMany", r.Filter, start)
+			if err != nil {
+				dbError(c, err, gin.H{"error": "Failed to repair documents", "results": results})
+				return
+			}
+			results = append(results, gin.H{"repair": r.Name, "repaired": result.ModifiedCount})
+			counts[r.Name] = result.ModifiedCount
+		}
+
+		if !dryRun {
+			recordAudit(c, "repair", nil, counts)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"dryRun": dryRun, "results": results})
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// statusClientClosedRequest is the non-standard 499 nginx logs for a
+// client that went away before the response; net/http has no name for it.
+const statusClientClosedRequest = 499
+
+// dbErrorStatus is the status for a failed database call, telling a slow
+// database from a broken one: 504 when err is a timeout (the request's DB
+// context ran out, or the server gave up), 499 when the client canceled
+// the request, and 500 for anything else.
+func dbErrorStatus(c *gin.Context, err error) int {
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(c.Request.Context().Err(), context.Canceled):
+		return statusClientClosedRequest
+	case errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// dbError writes body as the response to a failed database call, with the
+// status from dbErrorStatus. For 504 and 499 the body's "error" says why,
+// e.g. "Failed to fetch documents: timed out"; any other fields of body are
+// sent as they are.
+func dbError(c *gin.Context, err error, body gin.H) {
+	status := dbErrorStatus(c, err)
+	switch status {
+	case statusClientClosedRequest:
+		body["error"] = fmt.Sprintf("%v: request canceled by the client", body["error"])
+	case http.StatusGatewayTimeout:
+		body["error"] = fmt.Sprintf("%v: timed out", body["error"])
+	}
+	c.JSON(status, body)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// fieldChanges compares the stored document before a patch with what the
+// patch applied and returns field -> {from, to} for the fields whose value
+// actually changed. A field that was missing has from null; an unset field
+// has to null.
+func fieldChanges(before, set bson.M, unset []string) bson.M {
+	changes := bson.M{}
+	for field, to := range set {
+		from, ok := before[field]
+		if ok && sameValue(from, to) {
+			continue
+		}
+		changes[field] = gin.H{"from": from, "to": to}
+	}
+	for _, field := range unset {
+		if from, ok := before[field]; ok {
+			changes[field] = gin.H{"from": from, "to": nil}
+		}
+	}
+	return changes
+}
+
+// sameValue reports whether a and b would be stored as the same value. They
+// are compared as relaxed extended JSON, so an int decoded as int32 equals
+// the int the request bound, and a []string equals the bson.A read back.
+func sameValue(a, b interface{}) bool {
+	ja, errA := bson.MarshalExtJSON(bson.M{"v": a}, false, false)
+	jb, errB := bson.MarshalExtJSON(bson.M{"v": b}, false, false)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// dumpHandler streams every document in coll as a JSON array of canonical
+// extended JSON, so ObjectIDs, dates and number types survive a round trip
+// through restoreHandler. Documents are written unmasked. If the cursor
+// fails part-way the closing "]" is left off, so a truncated dump can't be
+// mistaken for a complete one: restoreHandler rejects it as unterminated.
+func dumpHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		ctx, cancel := dbContext(c, 10*time.Minute)
+		defer cancel()
+
+		start := time.Now()
+		cursor, err := coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch documents"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		c.Header("Content-Type", "application/json")
+		c.Header("Content-Disposition", `attachment; filename="`+coll.Name()+`.json"`)
+		c.Status(http.StatusOK)
+
+		c.Writer.WriteString("[")
+		for n := 0; cursor.Next(ctx); n++ {
+			var doc []byte
+			if doc, err = bson.MarshalExtJSON(cursor.Current, true, false); err != nil {
+				break
+			}
+			if n > 0 {
+				c.Writer.WriteString(",\n")
+			}
+			if _, err := c.Writer.Write(doc); err != nil {
+				recordDBTime(c, "find", "dump", start)
+				return // client went away
+			}
+		}
+		if err == nil {
+			err = cursor.Err()
+		}
+		recordDBTime(c, "find", "dump", start)
+		if err != nil {
+			log.Printf("Dump of %s failed part-way: %v", coll.Name(), err)
+			return
+		}
+		c.Writer.WriteString("]\n")
+	}
+}
+
+// restoreHandler reads a JSON array of extended JSON documents, as written by
+// dumpHandler, and inserts them unordered in batches of cfg.ImportBatchSize.
+// Documents keep their _id, so restoring over existing data reports each
+// clash as an error rather than overwriting it. The "line" of each reported
+// error is the 1-based position of the document in the array. The body is
+// capped at MAX_IMPORT_BYTES.
+func restoreHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		ctx, cancel := dbContext(c, 10*time.Minute)
+		defer cancel()
+
+		report := importReport{Errors: []lineError{}}
+		var batch []interface{}
+		var batchPos []int
+
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			start := time.Now()
+			result, err := coll.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false))
+			recordDBTime(c, "insertMany", "restore", start)
+
+			var bulkErr mongo.BulkWriteException
+			switch {
+			case err == nil:
+				report.Inserted += len(result.InsertedIDs)
+			case errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil:
+				report.Inserted += len(batch) - len(bulkErr.WriteErrors)
+				for _, we := range bulkErr.WriteErrors {
+					report.fail(batchPos[we.Index], we.Message)
+				}
+			default:
+				return err
+			}
+
+			batch, batchPos = batch[:0], batchPos[:0]
+			return nil
+		}
+
+		dec := json.NewDecoder(&importLimitReader{r: c.Request.Body, max: cfg.MaxImportBytes})
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Body must be a JSON array of documents"})
+			return
+		}
+
+		pos := 0
+		for dec.More() {
+			pos++
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); errors.Is(err, errImportTooLarge) {
+				tooLargeResponse(c, report)
+				return
+			} else if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Malformed dump: " + err.Error(), "report": report})
+				return
+			}
+
+			var doc bson.D
+			if err := bson.UnmarshalExtJSON(raw, true, &doc); err != nil {
+				report.fail(pos, err.Error())
+				continue
+			}
+			batch = append(batch, doc)
+			batchPos = append(batchPos, pos)
+
+			if int64(len(batch)) >= cfg.ImportBatchSize {
+				if err := flush(); err != nil {
+					dbError(c, err, gin.H{"error": "Failed to insert documents", "report": report})
+					return
+				}
+			}
+		}
+		// More reports false on a read error as well as at the closing
+		// bracket, so make sure it really was the end of the array.
+		if tok, err := dec.Token(); errors.Is(err, errImportTooLarge) {
+			tooLargeResponse(c, report)
+			return
+		} else if err != nil || tok != json.Delim(']') {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Malformed dump: unterminated array", "report": report})
+			return
+		}
+		if err := flush(); err != nil {
+			dbError(c, err, gin.H{"error": "Failed to insert documents", "report": report})
+			return
+		}
+
+		recordAudit(c, "restore", nil, bson.M{"inserted": report.Inserted, "failed": report.ErrorCount})
+
+		c.JSON(http.StatusOK, report)
+	}
+}
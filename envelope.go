@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// envelopeMediaType lets a client opt into the wrapped response shape per
+// request, independent of RESPONSE_ENVELOPE.
+const envelopeMediaType = "application/vnd.firstrender.envelope+json"
+
+// wantsEnvelope reports whether the response should be wrapped as
+// {"data": ..., "meta": {...}} instead of the bare payload.
+func wantsEnvelope(c *gin.Context) bool {
+	return cfg.ResponseEnvelope || strings.Contains(c.GetHeader("Accept"), envelopeMediaType)
+}
+
+// respond writes data as JSON, wrapping it with meta when the envelope mode
+// is active. The documents in data are rendered with renderDocs. meta may
+// be nil for item responses.
+func respond(c *gin.Context, status int, data interface{}, meta gin.H) {
+	renderDocs(c, data)
+	if !wantsEnvelope(c) {
+		c.JSON(status, data)
+		return
+	}
+	if meta == nil {
+		meta = gin.H{}
+	}
+	c.JSON(status, gin.H{"data": data, "meta": meta})
+}
+
+// renderDocs turns the stored documents in data into their wire form, in
+// place: timestamps in the ?tz= zone, then keys in the JSON_NAMING style.
+// Handlers that write documents with c.JSON rather than respond call it
+// themselves.
+func renderDocs(c *gin.Context, data interface{}) {
+	localizeTimes(data, requestLocation(c))
+	if cfg.JSONNaming == namingCamel {
+		camelKeys(data)
+	}
+}
+
+// eachDoc calls fn for every document in data, following the maps and
+// slices handlers respond with, so documents nested in a wrapper such as
+// {"current": ..., "previous": ...} are visited too. A document is visited
+// before the documents nested in it.
+func eachDoc(data interface{}, fn func(doc map[string]interface{})) {
+	switch v := data.(type) {
+	case bson.M:
+		eachDoc(map[string]interface{}(v), fn)
+	case gin.H:
+		eachDoc(map[string]interface{}(v), fn)
+	case map[string]interface{}:
+		fn(v)
+		for _, value := range v {
+			eachDoc(value, fn)
+		}
+	case []bson.M:
+		for _, doc := range v {
+			eachDoc(doc, fn)
+		}
+	case []gin.H:
+		for _, doc := range v {
+			eachDoc(doc, fn)
+		}
+	case bson.A:
+		for _, item := range v {
+			eachDoc(item, fn)
+		}
+	case []interface{}:
+		for _, item := range v {
+			eachDoc(item, fn)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errorStats counts 4xx and 5xx responses per route ("METHOD /pattern").
+type errorStats struct {
+	mu     sync.Mutex
+	counts map[string]map[string]int64
+}
+
+var routeErrors = &errorStats{counts: map[string]map[string]int64{}}
+
+func (s *errorStats) record(route string, status int) {
+	var bucket string
+	switch {
+	case status >= 500:
+		bucket = "5xx"
+	case status >= 400:
+		bucket = "4xx"
+	default:
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counts[route] == nil {
+		s.counts[route] = map[string]int64{}
+	}
+	s.counts[route][bucket]++
+}
+
+// snapshot returns a copy that is safe to serialize outside the lock.
+func (s *errorStats) snapshot() map[string]map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]map[string]int64, len(s.counts))
+	for route, buckets := range s.counts {
+		cp := make(map[string]int64, len(buckets))
+		for b, n := range buckets {
+			cp[b] = n
+		}
+		out[route] = cp
+	}
+	return out
+}
+
+// errorStatsHandler serves GET /stats/errors.
+func errorStatsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, routeErrors.snapshot())
+}
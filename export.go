@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// csvColumns are the fields written by the CSV export, in order, when the
+// request does not pick its own with ?columns=.
+var csvColumns = []string{"_id", "name", "age", "email", "created_at", "updated_at"}
+
+// csvSelectable is the whitelist of fields ?columns= may name.
+var csvSelectable = map[string]bool{
+	"_id":            true,
+	"name":           true,
+	"age":            true,
+	"email":          true,
+	"active":         true,
+	"position":       true,
+	"student_number": true,
+	"created_at":     true,
+	"updated_at":     true,
+}
+
+// parseCSVColumns reads ?columns=name,email. The order given is the column
+// order; an empty param selects csvColumns.
+func parseCSVColumns(param string) ([]string, error) {
+	if param == "" {
+		return csvColumns, nil
+	}
+
+	var cols []string
+	seen := map[string]bool{}
+	for _, col := range strings.Split(param, ",") {
+		col = strings.TrimSpace(col)
+		if col == "" {
+			continue
+		}
+		if !csvSelectable[col] {
+			return nil, fmt.Errorf("unknown column %q", col)
+		}
+		if seen[col] {
+			return nil, fmt.Errorf("duplicate column %q", col)
+		}
+		seen[col] = true
+		cols = append(cols, col)
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("columns must name at least one field")
+	}
+	return cols, nil
+}
+
+// exportCSVHandler streams coll as CSV. It takes the same filter and sort
+// params as the list endpoint, ?columns= to choose the fields written, and
+// ?skip= / ?limit= so large exports can be fetched in pages; the range
+// actually served is reported in X-Export-Range as "<first>-<last>/<total>".
+// The status is sent before the first row, so a cursor that fails part-way
+// is reported in an X-Export-Error trailer instead.
+func exportCSVHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		ctx, cancel := dbContext(c, 2*time.Minute)
+		defer cancel()
+
+		limit, skip, err := parsePagination(c.Query("limit"), c.Query("skip"), cfg.MaxExportPageSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter, err := parseFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		cols, err := parseCSVColumns(c.Query("columns"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		projection := bson.M{}
+		for _, col := range cols {
+			projection[col] = 1
+		}
+		findOptions := options.Find().SetLimit(limit).SetSkip(skip).SetProjection(projection)
+		sort, err := effectiveSort(c.Query("sort"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		findOptions.SetSort(sort)
+
+		start := time.Now()
+		total, err := coll.CountDocuments(ctx, filter)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to count documents"})
+			return
+		}
+
+		cursor, err := coll.Find(ctx, filter, findOptions)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch documents"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		// The range header has to go out before the body, so compute it from
+		// the count rather than from the rows streamed.
+		served := total - skip
+		if served < 0 {
+			served = 0
+		}
+		if served > limit {
+			served = limit
+		}
+		if served > 0 {
+			c.Header("X-Export-Range", fmt.Sprintf("%d-%d/%d", skip, skip+served-1, total))
+		} else {
+			c.Header("X-Export-Range", fmt.Sprintf("*/%d", total))
+		}
+		c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="students.csv"`)
+		c.Header("Trailer", "X-Export-Error")
+		c.Status(http.StatusOK)
+
+		w := csv.NewWriter(c.Writer)
+		w.Write(cols)
+
+		for cursor.Next(ctx) {
+			var doc bson.M
+			if err = cursor.Decode(&doc); err != nil {
+				break
+			}
+			maskFields(c, doc)
+			w.Write(csvRow(doc, cols))
+		}
+		if err == nil {
+			err = cursor.Err()
+		}
+		w.Flush()
+		recordDBTime(c, "find", filter, start)
+		if err != nil {
+			log.Printf("request %s: CSV export failed part-way: %v", requestID(c), err)
+			c.Writer.Header().Set("X-Export-Error", "Export failed before all rows were sent")
+		}
+	}
+}
+
+// writeCSV writes docs as a CSV response with the given columns.
+func writeCSV(c *gin.Context, status int, docs []bson.M, cols []string) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(status)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write(cols)
+	for _, doc := range docs {
+		w.Write(csvRow(doc, cols))
+	}
+	w.Flush()
+}
+
+// writeCompact writes docs as {"columns": [...], "rows": [[...], ...]}, so
+// large lists don't repeat every key per document. Cells keep their JSON
+// types, with null for a missing field. cols is validated like the CSV
+// columns.
+func writeCompact(c *gin.Context, status int, docs []bson.M, cols []string) {
+	rows := make([][]interface{}, len(docs))
+	for i, doc := range docs {
+		row := make([]interface{}, len(cols))
+		for j, col := range cols {
+			row[j] = doc[col]
+		}
+		rows[i] = row
+	}
+	c.Header("Content-Type", mimeCompact)
+	c.JSON(status, gin.H{"columns": cols, "rows": rows})
+}
+
+// csvRow formats doc as one CSV record in cols order.
+func csvRow(doc bson.M, cols []string) []string {
+	row := make([]string, len(cols))
+	for i, col := range cols {
+		row[i] = csvValue(doc[col])
+	}
+	return row
+}
+
+// csvValue formats a decoded BSON value for a CSV cell.
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.DateTime:
+		return v.Time().UTC().Format(time.RFC3339)
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// exportNDJSONHandler streams coll as JSON Lines, one document per line,
+// flushing after each so nothing is buffered and tools like jq can consume
+// it as it arrives. It accepts the list filter and sort params. The status
+// is sent before the first document, so a cursor that fails part-way ends
+// the stream with a last line of the form {"error": "..."} instead.
+func exportNDJSONHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		ctx, cancel := dbContext(c, 10*time.Minute)
+		defer cancel()
+
+		filter, err := parseFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		findOptions := options.Find()
+		if spec := c.Query("sort"); spec != "" {
+			sort, err := parseSort(spec)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			findOptions.SetSort(sort)
+		}
+
+		start := time.Now()
+		cursor, err := coll.Find(ctx, filter, findOptions)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch documents"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+
+		enc := json.NewEncoder(c.Writer)
+		for cursor.Next(ctx) {
+			var doc bson.M
+			if err = cursor.Decode(&doc); err != nil {
+				break
+			}
+			maskFields(c, doc)
+			renderDocs(c, doc)
+			if err := enc.Encode(doc); err != nil {
+				recordDBTime(c, "find", filter, start)
+				return // client went away
+			}
+			c.Writer.Flush()
+		}
+		if err == nil {
+			err = cursor.Err()
+		}
+		recordDBTime(c, "find", filter, start)
+		if err != nil {
+			log.Printf("NDJSON export failed part-way: %v", err)
+			enc.Encode(gin.H{"error": "Export failed before all documents were sent"})
+			c.Writer.Flush()
+		}
+	}
+}
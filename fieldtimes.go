@@ -0,0 +1,46 @@
+package main
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// fieldTimestampsKey holds a map of field name -> time it last changed.
+const fieldTimestampsKey = "field_updated_at"
+
+// patchPipeline builds an update pipeline that applies set, removes the
+// unset fields, and stamps field_updated_at.<field> with now, but only for
+// fields whose stored value actually changes. Values are wrapped in
+// $literal so a string such as "$name" isn't read as a field path.
+func patchPipeline(set bson.M, unset []string, now time.Time) mongo.Pipeline {
+	stamps := bson.M{}
+	values := bson.M{"updated_at": now}
+	for field, v := range set {
+		value := bson.M{"$literal": v}
+		values[field] = value
+		stamps[fieldTimestampsKey+"."+field] = bson.M{"$cond": bson.A{
+			bson.M{"$ne": bson.A{"$" + field, value}},
+			now,
+			"$" + fieldTimestampsKey + "." + field,
+		}}
+	}
+	for _, field := range unset {
+		stamps[fieldTimestampsKey+"."+field] = bson.M{"$cond": bson.A{
+			bson.M{"$ne": bson.A{bson.M{"$type": "$" + field}, "missing"}},
+			now,
+			"$" + fieldTimestampsKey + "." + field,
+		}}
+	}
+
+	// Stamps must be computed before the values are overwritten.
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: stamps}},
+		{{Key: "$set", Value: values}},
+	}
+	if len(unset) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$unset", Value: unset}})
+	}
+	return pipeline
+}
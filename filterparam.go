@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// filterFields and filterOperators whitelist what a ?filter= JSON document
+// may contain, so clients can't smuggle in $where or other expensive or
+// dangerous operators.
+var (
+	filterFields = map[string]bool{
+		"name": true, "age": true, "email": true, "active": true, "position": true,
+		"student_number": true,
+	}
+	filterOperators = map[string]bool{
+		"$eq": true, "$ne": true, "$gt": true, "$gte": true, "$lt": true, "$lte": true,
+		"$in": true, "$nin": true, "$exists": true,
+	}
+)
+
+// parseFilterParam decodes a ?filter= value such as
+// {"age":{"$lt":18},"active":false} into a Mongo filter. Each field maps to
+// either a literal (equality) or an object of whitelisted operators. Fields
+// the caller may not see are refused too, since matching on them would
+// reveal their values.
+func parseFilterParam(c *gin.Context, raw string) (bson.M, error) {
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.UseNumber()
+
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("filter must be a JSON object")
+	}
+
+	filter := bson.M{}
+	for name, v := range doc {
+		field := storedName(name)
+		if !filterFields[field] || !canSee(c, field) {
+			return nil, fmt.Errorf("cannot filter on %q", name)
+		}
+
+		ops, ok := v.(map[string]interface{})
+		if !ok {
+			filter[field] = filterValue(v)
+			continue
+		}
+
+		cond := bson.M{}
+		for op, operand := range ops {
+			if !filterOperators[op] {
+				return nil, fmt.Errorf("operator %q is not allowed", op)
+			}
+			cond[op] = filterValue(operand)
+		}
+		filter[field] = cond
+	}
+	return filter, nil
+}
+
+// filterValue converts decoded JSON numbers to int64 or float64 so they
+// compare correctly against stored values.
+func filterValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		out := make(bson.A, len(v))
+		for i, item := range v {
+			out[i] = filterValue(item)
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// groupableFields is the whitelist for GET /students/group-by/:field, mapped
+// to the $group key expression. Students stored before the active flag
+// existed are grouped as active.
+var groupableFields = map[string]interface{}{
+	"age":    "$age",
+	"name":   "$name",
+	"active": bson.M{"$ifNull": bson.A{"$active", true}},
+}
+
+// groupByHandler counts the students of coll per distinct value of :field,
+// most common first, as [{value, count}]. The list endpoint's filter params
+// scope which students are counted.
+func groupByHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		field := c.Param("field")
+		key, ok := groupableFields[field]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cannot group by " + field})
+			return
+		}
+
+		filter, err := parseFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := dbContext(c, 10*time.Second)
+		defer cancel()
+
+		pipeline := mongo.Pipeline{
+			{{Key: "$match", Value: filter}},
+			{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: key},
+				{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			}}},
+			{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+			{{Key: "$project", Value: bson.D{
+				{Key: "_id", Value: 0},
+				{Key: "value", Value: "$_id"},
+				{Key: "count", Value: 1},
+			}}},
+		}
+
+		start := time.Now()
+		cursor, err := coll.Aggregate(ctx, pipeline)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to aggregate documents"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		results := []bson.M{}
+		err = cursor.All(ctx, &results)
+		recordDBTime(c, "aggregate", "group by "+field, start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to decode documents"})
+			return
+		}
+
+		respond(c, http.StatusOK, results, gin.H{"field": field, "count": len(results)})
+	}
+}
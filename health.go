@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// dbHealthy is kept up to date by monitorDB. It starts true because main
+// has already pinged successfully before serving.
+var dbHealthy atomic.Bool
+
+// monitorDB pings the live MongoDB client every interval until ctx is
+// cancelled, updating dbHealthy and logging each healthy/unhealthy
+// transition.
+func monitorDB(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := liveConn.Load().client.Ping(pingCtx, readpref.Primary())
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		healthy := err == nil
+		if dbHealthy.Swap(healthy) != healthy {
+			if healthy {
+				log.Println("MongoDB is healthy again")
+			} else {
+				log.Println("MongoDB became unhealthy:", err)
+			}
+		}
+	}
+}
+
+// healthHandler reports the last known database state.
+func healthHandler(c *gin.Context) {
+	if !dbHealthy.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unhealthy", "database": "down"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "database": "up"})
+}
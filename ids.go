@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var errInvalidID = errors.New("invalid student ID")
+
+// customIDPattern is the accepted shape for client-supplied ids such as a
+// student number. 24-character hex strings are excluded so a custom id can
+// never be mistaken for an ObjectID.
+var (
+	customIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	objectIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{24}$`)
+)
+
+// validCustomID reports whether s may be used as a custom _id.
+func validCustomID(s string) bool {
+	return customIDPattern.MatchString(s) && !objectIDPattern.MatchString(s)
+}
+
+// parseStudentID turns an :id path param into the _id value to query with:
+// an ObjectID for 24-char hex, otherwise the raw string when CUSTOM_IDS is
+// enabled.
+func parseStudentID(s string) (interface{}, error) {
+	if oid, err := primitive.ObjectIDFromHex(s); err == nil {
+		return oid, nil
+	}
+	if cfg.CustomIDs && validCustomID(s) {
+		return s, nil
+	}
+	return nil, errInvalidID
+}
+
+// idString formats an _id value for URLs.
+func idString(id interface{}) string {
+	if oid, ok := id.(primitive.ObjectID); ok {
+		return oid.Hex()
+	}
+	return fmt.Sprint(id)
+}
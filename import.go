@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxImportLineBytes = 1 << 20 // longest accepted NDJSON line
+	maxReportedErrors  = 1000    // per-line errors returned in the response
+)
+
+// lineError describes why one NDJSON line was not imported.
+type lineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// importReport accumulates the outcome of an import as it streams.
+type importReport struct {
+	Inserted   int         `json:"inserted"`
+	ErrorCount int         `json:"errorCount"`
+	Errors     []lineError `json:"errors"`
+}
+
+func (r *importReport) fail(line int, msg string) {
+	r.ErrorCount++
+	if len(r.Errors) < maxReportedErrors {
+		r.Errors = append(r.Errors, lineError{Line: line, Error: msg})
+	}
+}
+
+// errImportTooLarge is returned by importLimitReader once more than
+// MAX_IMPORT_BYTES have been read.
+var errImportTooLarge = errors.New("import body too large")
+
+// importLimitReader counts the bytes read from a streamed import body and
+// fails as soon as the total passes max, so an oversized upload is cut off
+// mid-stream instead of being consumed to the end.
+type importLimitReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+func (l *importLimitReader) Read(p []byte) (int, error) {
+	if l.n > l.max {
+		return 0, errImportTooLarge
+	}
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.max {
+		return n, errImportTooLarge
+	}
+	return n, err
+}
+
+// tooLargeResponse is the 413 sent when an import passes MAX_IMPORT_BYTES.
+// The report says how much was inserted before the cut-off; those
+// documents are not rolled back.
+func tooLargeResponse(c *gin.Context, report importReport) {
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error":  fmt.Sprintf("Import exceeds %d bytes", cfg.MaxImportBytes),
+		"report": report,
+	})
+}
+
+// importNDJSONHandler streams newline-delimited JSON students from the
+// request body and inserts them in batches of cfg.ImportBatchSize, so only
+// one batch is held in memory at a time. Lines are checked with
+// checkStudentFields; uniqueness is not checked per line. The body is
+// capped at MAX_IMPORT_BYTES.
+func importNDJSONHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		dst := fastWrites(coll, c.Query("fastWrite") == "true")
+
+		ctx, cancel := dbContext(c, 10*time.Minute)
+		defer cancel()
+
+		report := importReport{Errors: []lineError{}}
+		var batch []interface{}
+		var batchLines []int
+
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			start := time.Now()
+			err := numberDocs(ctx, coll, batch)
+			recordDBTime(c, "findOneAndUpdate", "next student numbers", start)
+			if err != nil {
+				return err
+			}
+
+			start = time.Now()
+			result, err := dst.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false))
+			recordDBTime(c, "insertMany", "import", start)
+
+			var bulkErr mongo.BulkWriteException
+			switch {
+			case err == nil:
+				report.Inserted += len(result.InsertedIDs)
+			case errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil:
+				report.Inserted += len(batch) - len(bulkErr.WriteErrors)
+				for _, we := range bulkErr.WriteErrors {
+					report.fail(batchLines[we.Index], we.Message)
+				}
+			default:
+				return err
+			}
+
+			batch, batchLines = batch[:0], batchLines[:0]
+			return nil
+		}
+
+		body := &importLimitReader{r: c.Request.Body, max: cfg.MaxImportBytes}
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 64*1024), maxImportLineBytes)
+
+		line := 0
+		for scanner.Scan() {
+			line++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+
+			var s Student
+			if err := decodeJSON([]byte(text), &s); err != nil {
+				report.fail(line, err.Error())
+				continue
+			}
+			if problems := checkStudentFields(s); len(problems) > 0 {
+				report.fail(line, strings.Join(problems, "; "))
+				continue
+			}
+
+			s.prepareInsert(time.Now().UTC())
+			batch = append(batch, s.insertDoc())
+			batchLines = append(batchLines, line)
+
+			if int64(len(batch)) >= cfg.ImportBatchSize {
+				if err := flush(); err != nil {
+					dbError(c, err, gin.H{"error": "Failed to insert documents", "report": report})
+					return
+				}
+			}
+		}
+		if err := scanner.Err(); errors.Is(err, errImportTooLarge) {
+			tooLargeResponse(c, report)
+			return
+		} else if err != nil {
+			report.fail(line+1, err.Error())
+		}
+		if err := flush(); err != nil {
+			dbError(c, err, gin.H{"error": "Failed to insert documents", "report": report})
+			return
+		}
+
+		recordAudit(c, "import", nil, bson.M{"inserted": report.Inserted, "failed": report.ErrorCount})
+
+		c.JSON(http.StatusOK, report)
+	}
+}
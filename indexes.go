@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ensureIndexes creates the indexes the API relies on. CreateMany is a
+// no-op for indexes that already exist with the same definition. Each step
+// runs even if an earlier one failed, e.g. on duplicate emails, and the
+// errors are returned together.
+func ensureIndexes(ctx context.Context, coll *mongo.Collection) error {
+	models := []mongo.IndexModel{
+		{
+			// Backs ?sort=age,name
+			Keys:    bson.D{{Key: "age", Value: 1}, {Key: "name", Value: 1}},
+			Options: options.Index().SetName("age_1_name_1"),
+		},
+		{
+			// Backs the Last-Modified lookup on GET /students
+			Keys:    bson.D{{Key: "updated_at", Value: -1}},
+			Options: options.Index().SetName("updated_at_-1"),
+		},
+		{
+			// Backs the soft-delete purge job; sparse since live students lack the field
+			Keys:    bson.D{{Key: softDeletedKey, Value: 1}},
+			Options: options.Index().SetName("deleted_at_1").SetSparse(true),
+		},
+		{
+			// Backs the keyset pagination of GET /students/by-name
+			Keys:    bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}},
+			Options: options.Index().SetName("name_1__id_1"),
+		},
+		{
+			// Guards against a student number being handed out twice, e.g.
+			// after a counter document was reset; sparse since students
+			// stored before numbering lack the field
+			Keys:    bson.D{{Key: "student_number", Value: 1}},
+			Options: options.Index().SetName(studentNumberIndexName).SetUnique(true).SetSparse(true),
+		},
+		{
+			// Multikey; backs ?tag= on list endpoints
+			Keys:    bson.D{{Key: "tags", Value: 1}},
+			Options: options.Index().SetName("tags_1"),
+		},
+		{
+			// Backs GET /students/text-search; a name hit outranks an email hit
+			Keys: bson.D{{Key: "name", Value: "text"}, {Key: "email", Value: "text"}},
+			Options: options.Index().
+				SetName("name_text_email_text").
+				SetWeights(bson.D{{Key: "name", Value: 10}, {Key: "email", Value: 2}}),
+		},
+	}
+
+	_, err := coll.Indexes().CreateMany(ctx, models)
+	return errors.Join(err, ensureNameIndex(ctx, coll), ensureEmailIndex(ctx, coll))
+}
+
+// emailIndexName is the unique index POST /students/upsert keys on.
+const emailIndexName = "email_1_unique"
+
+// studentNumberIndexName is the unique index on student_number.
+const studentNumberIndexName = "student_number_1"
+
+// ensureEmailIndex makes email unique among the students that have one;
+// email is optional, so students without it are left out of the index. It
+// fails while two students share an email.
+func ensureEmailIndex(ctx context.Context, coll *mongo.Collection) error {
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().
+			SetName(emailIndexName).
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"email": bson.M{"$type": "string"}}),
+	})
+	return err
+}
+
+// nameIndexName is the unique, case-insensitive index on name.
+const nameIndexName = "name_1_ci"
+
+// nameCollation makes "John" and "john" equal. A query only uses the name
+// index, and only agrees with it about what counts as a duplicate, when it
+// is run with this same collation.
+var nameCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// ensureNameIndex creates the unique name index under nameCollation, then
+// drops any older case-sensitive index on name so the two don't disagree.
+// The old index is only dropped once the new one exists, so names stay
+// unique throughout. It fails while the collection holds names that differ
+// only by case; resolve those (see GET /students/duplicates) and restart.
+func ensureNameIndex(ctx context.Context, coll *mongo.Collection) error {
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().
+			SetName(nameIndexName).
+			SetUnique(true).
+			SetCollation(nameCollation),
+	})
+	if err != nil {
+		return err
+	}
+
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+	var indexes []struct {
+		Name      string `bson:"name"`
+		Key       bson.D `bson:"key"`
+		Collation bson.M `bson:"collation"`
+	}
+	if err := cursor.All(ctx, &indexes); err != nil {
+		return err
+	}
+	for _, idx := range indexes {
+		if idx.Name != nameIndexName && len(idx.Key) == 1 && idx.Key[0].Key == "name" && idx.Collation == nil {
+			if _, err := coll.Indexes().DropOne(ctx, idx.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// duplicateMessage returns the 409 message for a write rejected by one of
+// the unique indexes, naming what clashed, or "" when err is not a
+// duplicate key error. The driver only reports the index by name in the
+// error message.
+func duplicateMessage(err error) string {
+	if !mongo.IsDuplicateKeyError(err) {
+		return ""
+	}
+	switch msg := err.Error(); {
+	case strings.Contains(msg, nameIndexName):
+		return "A student with this name already exists"
+	case strings.Contains(msg, emailIndexName):
+		return "A student with this email already exists"
+	case strings.Contains(msg, studentNumberIndexName):
+		return "The assigned student number is already in use"
+	case strings.Contains(msg, "index: _id_ "):
+		return "A student with this id already exists"
+	}
+	return "A student with these values already exists"
+}
+
+// isDuplicateID reports whether err is a write rejected by the _id index.
+func isDuplicateID(err error) bool {
+	return mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), "index: _id_ ")
+}
+
+// ensureAuditIndexes backs the per-student history lookup.
+func ensureAuditIndexes(ctx context.Context, coll *mongo.Collection) error {
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "target_id", Value: 1}, {Key: "timestamp", Value: 1}},
+		Options: options.Index().SetName("target_id_1_timestamp_1"),
+	})
+	return err
+}
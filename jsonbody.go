@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// bindJSON is ShouldBindJSON with guards against pathological payloads: the
+// body is capped at cfg.MaxBodyBytes, nesting deeper than cfg.MaxJSONDepth
+// is rejected before decoding, and the body is decoded with decodeJSON. The
+// result is validated against its binding tags like ShouldBindJSON does.
+func bindJSON(c *gin.Context, v interface{}) error {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, cfg.MaxBodyBytes))
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			return fmt.Errorf("request body exceeds %d bytes", tooBig.Limit)
+		}
+		return err
+	}
+	if err := checkJSONDepth(body, cfg.MaxJSONDepth); err != nil {
+		return err
+	}
+
+	if err := decodeJSON(body, v); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(v)
+}
+
+// bindBody binds a JSON or form-encoded body by Content-Type, so plain HTML
+// forms can post as well. Anything that is not a form goes through bindJSON
+// and its guards; forms are held to the same size cap and validation.
+func bindBody(c *gin.Context, v interface{}) error {
+	switch c.ContentType() {
+	case binding.MIMEPOSTForm, binding.MIMEMultipartPOSTForm:
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, cfg.MaxBodyBytes)
+		return c.ShouldBind(v)
+	}
+	return bindJSON(c, v)
+}
+
+// decodeJSON unmarshals exactly one JSON value from data into v. With
+// STRICT_JSON, fields v has no place for are an error naming every one of
+// them, not just the first as DisallowUnknownFields would.
+func decodeJSON(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if cfg.StrictJSON {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("request body is empty")
+		}
+		if cfg.StrictJSON && strings.HasPrefix(err.Error(), "json: unknown field ") {
+			if fields := unknownFields(data, reflect.TypeOf(v), ""); len(fields) > 0 {
+				return fmt.Errorf("unknown fields: %s", strings.Join(fields, ", "))
+			}
+		}
+		return err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("unexpected data after JSON body")
+	}
+	return nil
+}
+
+var jsonUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// unknownFields lists the keys in data, as dotted paths under prefix, that
+// have no matching field in t. It follows nested structs and slices of
+// them the way encoding/json would, including its case-insensitive key
+// matching; types with their own UnmarshalJSON are treated as leaves.
+func unknownFields(data []byte, t reflect.Type, prefix string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(jsonUnmarshaler) {
+		return nil
+	}
+
+	var unknown []string
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if json.Unmarshal(data, &items) != nil {
+			return nil
+		}
+		for i, item := range items {
+			unknown = append(unknown, unknownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", prefix, i))...)
+		}
+
+	case reflect.Struct:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(data, &obj) != nil {
+			return nil
+		}
+		fields := jsonFields(t)
+		for key, raw := range obj {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			ft, ok := fields[strings.ToLower(key)]
+			if !ok {
+				unknown = append(unknown, path)
+				continue
+			}
+			unknown = append(unknown, unknownFields(raw, ft, path)...)
+		}
+		sort.Strings(unknown)
+	}
+	return unknown
+}
+
+// jsonFields maps the lower-cased JSON names of t's decodable fields to
+// their types, flattening embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for k, v := range jsonFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = f.Type
+	}
+	return fields
+}
+
+// checkJSONDepth rejects data whose objects and arrays nest deeper than max.
+// It is a single byte scan, so it costs far less than a decode of the same
+// payload and never recurses.
+func checkJSONDepth(data []byte, max int64) error {
+	var depth int64
+	inString, escaped := false, false
+	for _, b := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case b == '\\':
+				escaped = true
+			case b == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch b {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+			if depth > max {
+				return fmt.Errorf("JSON nesting exceeds %d levels", max)
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// byNameHandler serves GET /students/by-name, a name-ordered listing paged
+// by keyset rather than offset: each page starts after the (name, _id) pair
+// given as ?afterName=&afterId=, so it is an index range scan on name_1__id_1
+// however deep the client pages, and rows don't shift when students are added
+// or removed in between. The response's "next" holds the afterName/afterId
+// for the following page, or null on the last one. ?limit= and the list
+// filter params apply as on GET /students. Students without a string name
+// have no place in the order and are left out.
+//
+// Names are compared bytewise, not with the case-insensitive name
+// collation, since that is the order the compound index is built in.
+func byNameHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		limit, _, err := parsePagination(c.Query("limit"), "", cfg.MaxPageSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter, err := parseFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		afterName, hasName := c.GetQuery("afterName")
+		afterIDParam, hasID := c.GetQuery("afterId")
+		if hasName != hasID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "afterName and afterId must be given together"})
+			return
+		}
+		keyset := bson.M{"name": bson.M{"$type": "string"}}
+		if hasID {
+			afterID, err := parseStudentID(afterIDParam)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "afterId: " + err.Error()})
+				return
+			}
+			keyset = bson.M{"$or": bson.A{
+				bson.M{"name": bson.M{"$gt": afterName}},
+				bson.M{"name": afterName, "_id": bson.M{"$gt": afterID}},
+			}}
+		}
+		filter = bson.M{"$and": bson.A{filter, keyset}}
+
+		ctx, cancel := dbContext(c, 10*time.Second)
+		defer cancel()
+
+		// One extra row tells us whether there is a next page.
+		findOptions := options.Find().
+			SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}).
+			SetLimit(limit + 1)
+		if projection := listProjection(c); projection != nil {
+			findOptions.SetProjection(projection)
+		}
+
+		start := time.Now()
+		cursor, err := coll.Find(ctx, filter, findOptions)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch documents"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		results := []bson.M{}
+		err = cursor.All(ctx, &results)
+		recordDBTime(c, "find", filter, start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to decode documents"})
+			return
+		}
+
+		var next gin.H
+		if int64(len(results)) > limit {
+			results = results[:limit]
+			last := results[len(results)-1]
+			next = gin.H{"afterName": last["name"], "afterId": idString(last["_id"])}
+		}
+
+		maskFields(c, results...)
+		renderDocs(c, results)
+		c.JSON(http.StatusOK, gin.H{"data": results, "next": next})
+	}
+}
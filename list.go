@@ -0,0 +1,179 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// listHandler serves a paginated, sortable, filterable listing of coll. It backs both
+// GET /students and GET /alumni, and answers HEAD with the same headers.
+// The page is written as JSON, CSV, XML or compact JSON depending on the
+// negotiated format.
+// Requests using ?page/?pageSize get a JSON body carrying the page
+// metadata alongside the data. ?withGroup=true adds each student's
+// AGE_GROUPS band as "ageGroup".
+func listHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		ctx, cancel := dbContext(c, 10*time.Second)
+		defer cancel()
+
+		// ?page/?pageSize is an alternative to ?limit/?skip that answers
+		// with the full page metadata instead of bare results.
+		paged := c.Query("page") != "" || c.Query("pageSize") != ""
+		var limit, skip, page int64
+		var err error
+		if paged {
+			if c.Query("limit") != "" || c.Query("skip") != "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "use either page/pageSize or limit/skip, not both"})
+				return
+			}
+			page, limit, err = parsePage(c.Query("page"), c.Query("pageSize"), cfg.MaxPageSize)
+			skip = (page - 1) * limit
+		} else {
+			limit, skip, err = parsePagination(c.Query("limit"), c.Query("skip"), cfg.MaxPageSize)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter, err := parseFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sort, err := effectiveSort(c.Query("sort"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		start := time.Now()
+		lastMod, err := lastModified(ctx, coll)
+		recordDBTime(c, "findOne", "last modified", start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch documents"})
+			return
+		}
+		if notModified(c, lastMod) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+
+		start = time.Now()
+		total, err := coll.CountDocuments(ctx, filter)
+		recordDBTime(c, "countDocuments", filter, start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to count documents"})
+			return
+		}
+
+		// Tell the client which limit was actually applied, since it may
+		// have been clamped to MAX_PAGE_SIZE.
+		c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+		c.Header("X-Limit", strconv.FormatInt(limit, 10))
+		c.Header("X-Skip", strconv.FormatInt(skip, 10))
+		c.Header("X-Sort", formatSort(sort))
+
+		// HEAD gets the same headers without fetching the page itself.
+		if c.Request.Method == http.MethodHead {
+			c.Header("Content-Type", "application/json; charset=utf-8")
+			c.Status(http.StatusOK)
+			return
+		}
+
+		projection := listProjection(c)
+		var cursor *mongo.Cursor
+		op := "find"
+		start = time.Now()
+		if c.Query("withGroup") == "true" {
+			// The band label is computed server-side, so the page has to
+			// come from an aggregation rather than a find.
+			pipeline := mongo.Pipeline{
+				{{Key: "$match", Value: filter}},
+				{{Key: "$sort", Value: sort}},
+				{{Key: "$skip", Value: skip}},
+				{{Key: "$limit", Value: limit}},
+			}
+			if projection != nil {
+				pipeline = append(pipeline, bson.D{{Key: "$project", Value: projection}})
+			}
+			pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.M{"ageGroup": ageGroupExpr(cfg.AgeGroups)}}})
+			op = "aggregate"
+			cursor, err = coll.Aggregate(ctx, pipeline)
+		} else {
+			findOptions := options.Find().SetLimit(limit).SetSkip(skip)
+			if projection != nil {
+				findOptions.SetProjection(projection)
+			}
+			findOptions.SetSort(sort)
+			cursor, err = coll.Find(ctx, filter, findOptions)
+		}
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch documents"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		var results []bson.M
+		err = cursor.All(ctx, &results)
+		recordDBTime(c, op, filter, start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to decode documents"})
+			return
+		}
+
+		maskFields(c, results...)
+
+		switch responseFormat(c) {
+		case mimeCSV:
+			cols, err := parseCSVColumns(c.Query("columns"))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			writeCSV(c, http.StatusOK, results, cols)
+			return
+		case mimeXML:
+			c.XML(http.StatusOK, toStudentList(results, requestLocation(c)))
+			return
+		case mimeCompact:
+			cols, err := parseCSVColumns(c.Query("columns"))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			writeCompact(c, http.StatusOK, results, cols)
+			return
+		}
+		if paged {
+			if results == nil {
+				results = []bson.M{}
+			}
+			// A page past the end yields empty data; totalPages still
+			// tells the client where the last page is.
+			totalPages := (total + limit - 1) / limit
+			renderDocs(c, results)
+			c.JSON(http.StatusOK, gin.H{
+				"data":       results,
+				"page":       page,
+				"pageSize":   limit,
+				"totalItems": total,
+				"totalPages": totalPages,
+				"hasNext":    page < totalPages,
+				"hasPrev":    page > 1,
+			})
+			return
+		}
+		respond(c, http.StatusOK, results, gin.H{"limit": limit, "skip": skip, "count": len(results), "total": total, "sort": formatSort(sort)})
+	}
+}
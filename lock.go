@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxLockTTL bounds ?ttl= on POST /students/:id/lock, so a forgotten lock
+// clears itself within the hour.
+const maxLockTTL = time.Hour
+
+// studentLock is the lock state stored on a student. The fields are absent
+// while it is unlocked; a lock whose locked_until has passed has expired
+// and counts as unlocked.
+type studentLock struct {
+	LockedBy    string    `bson:"locked_by"`
+	LockedUntil time.Time `bson:"locked_until"`
+}
+
+// heldByOther reports whether the lock is live and held by someone other
+// than owner, the caller's callerEditor. A caller naming no editor owns no
+// lock, so any live lock is someone else's.
+func (l studentLock) heldByOther(owner string, now time.Time) bool {
+	return l.LockedBy != "" && l.LockedBy != owner && l.LockedUntil.After(now)
+}
+
+// errLocked is a write refused because someone else holds a live lock on
+// the student.
+type errLocked struct{ lock studentLock }
+
+func (e errLocked) Error() string { return "student is locked by " + e.lock.LockedBy }
+
+// docLock reads the lock state off a decoded student document.
+func docLock(doc bson.M) studentLock {
+	var l studentLock
+	l.LockedBy, _ = doc["locked_by"].(string)
+	if until, ok := doc["locked_until"].(primitive.DateTime); ok {
+		l.LockedUntil = until.Time()
+	}
+	return l
+}
+
+// writable returns live(filter), also leaving out, when HONOR_LOCKS is on,
+// students someone other than the calling editor holds a live lock on. Writes that
+// select students by filter use it, so a locked student is skipped even if
+// it was locked after any check the handler made.
+func writable(c *gin.Context, filter bson.M) bson.M {
+	f := live(filter)
+	if cfg.HonorLocks {
+		f["$nor"] = bson.A{lockedByOther(callerEditor(c), time.Now().UTC())}
+	}
+	return f
+}
+
+// lockedByOther matches students with a live lock held by someone other
+// than owner.
+func lockedByOther(owner string, now time.Time) bson.M {
+	return bson.M{"locked_by": bson.M{"$exists": true, "$ne": owner}, "locked_until": bson.M{"$gt": now}}
+}
+
+// findLocked returns the students matching filter that someone other than
+// the calling editor holds a live lock on, keyed by idString of their _id, with
+// key ("email" for upserts) also projected. It is nil when HONOR_LOCKS is
+// off. Bulk writes use it to report locked students as such rather than
+// as missing.
+func findLocked(ctx context.Context, c *gin.Context, coll *mongo.Collection, filter bson.M) (map[string]bson.M, error) {
+	if !cfg.HonorLocks {
+		return nil, nil
+	}
+	f := live(filter)
+	for k, v := range lockedByOther(callerEditor(c), time.Now().UTC()) {
+		f[k] = v
+	}
+
+	start := time.Now()
+	opts := options.Find().SetProjection(bson.M{"email": 1, "locked_by": 1, "locked_until": 1})
+	cursor, err := coll.Find(ctx, f, opts)
+	if err != nil {
+		return nil, err
+	}
+	var docs []bson.M
+	err = cursor.All(ctx, &docs)
+	recordDBTime(c, "find", "locked students", start)
+	if err != nil {
+		return nil, err
+	}
+
+	locked := map[string]bson.M{}
+	for _, doc := range docs {
+		locked[idString(doc["_id"])] = doc
+	}
+	return locked, nil
+}
+
+// lockConflict is the 409 for a student someone else holds the lock on.
+func lockConflict(c *gin.Context, l studentLock) {
+	c.JSON(http.StatusConflict, gin.H{
+		"error":       "Student is locked by " + l.LockedBy,
+		"lockedBy":    l.LockedBy,
+		"lockedUntil": l.LockedUntil,
+	})
+}
+
+// findLock reads the lock state of student id; mongo.ErrNoDocuments means
+// there is no such student.
+func findLock(c *gin.Context, coll *mongo.Collection, id interface{}) (studentLock, error) {
+	ctx, cancel := dbContext(c, 5*time.Second)
+	defer cancel()
+
+	var l studentLock
+	start := time.Now()
+	err := coll.FindOne(ctx, live(bson.M{"_id": id}), options.FindOne().SetProjection(bson.M{"locked_by": 1, "locked_until": 1})).Decode(&l)
+	recordDBTime(c, "findOne", "lock of "+idString(id), start)
+	return l, err
+}
+
+// lockHandler serves POST /students/:id/lock (admin), which locks the
+// student for ?ttl= (default LOCK_TTL, at most an hour) for the editor the
+// request names in X-Editor; the header is required. The conditional
+// update only takes a lock that is free, expired or already the editor's,
+// so two editors can't both get it; an editor renews its own lock the same
+// way. Someone else's live lock is a 409 naming the holder.
+func lockHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+		id := studentID(c)
+
+		owner := callerEditor(c)
+		if owner == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": editorHeader + " header is required"})
+			return
+		}
+		ttl := cfg.LockTTL
+		if raw := c.Query("ttl"); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil || d <= 0 || d > maxLockTTL {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "ttl must be a duration such as 10m, at most 1h"})
+				return
+			}
+			ttl = d
+		}
+
+		ctx, cancel := dbContext(c, 5*time.Second)
+		defer cancel()
+
+		now := time.Now().UTC()
+		lock := studentLock{LockedBy: owner, LockedUntil: now.Add(ttl)}
+		start := time.Now()
+		result, err := coll.UpdateOne(ctx,
+			live(bson.M{"_id": id, "$or": bson.A{
+				bson.M{"locked_by": bson.M{"$exists": false}},
+				bson.M{"locked_until": bson.M{"$lte": now}},
+				bson.M{"locked_by": owner},
+			}}),
+			bson.M{"$set": bson.M{"locked_by": lock.LockedBy, "locked_until": lock.LockedUntil}},
+		)
+		recordDBTime(c, "updateOne", bson.M{"_id": id}, start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to lock student"})
+			return
+		}
+
+		if result.MatchedCount == 0 {
+			held, err := findLock(c, coll, id)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+				return
+			}
+			if err != nil {
+				dbError(c, err, gin.H{"error": "Failed to fetch document"})
+				return
+			}
+			lockConflict(c, held)
+			return
+		}
+
+		recordAudit(c, "lock", id, bson.M{"locked_by": lock.LockedBy, "locked_until": lock.LockedUntil})
+
+		c.JSON(http.StatusOK, gin.H{"id": id, "lockedBy": lock.LockedBy, "lockedUntil": lock.LockedUntil})
+	}
+}
+
+// unlockHandler serves DELETE /students/:id/lock (admin), which releases
+// the lock of the editor named in X-Editor, required unless ?force=true.
+// Unlocking a student that isn't locked, or whose lock expired, succeeds,
+// so a retried unlock is safe. Releasing someone else's live lock is a
+// 409, unless ?force=true.
+func unlockHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+		id := studentID(c)
+
+		owner := callerEditor(c)
+		force := c.Query("force") == "true"
+		if owner == "" && !force {
+			c.JSON(http.StatusBadRequest, gin.H{"error": editorHeader + " header is required"})
+			return
+		}
+
+		ctx, cancel := dbContext(c, 5*time.Second)
+		defer cancel()
+
+		filter := live(bson.M{"_id": id, "locked_by": bson.M{"$exists": true}})
+		if !force {
+			filter["$or"] = bson.A{
+				bson.M{"locked_by": owner},
+				bson.M{"locked_until": bson.M{"$lte": time.Now().UTC()}},
+			}
+		}
+		start := time.Now()
+		result, err := coll.UpdateOne(ctx, filter, bson.M{"$unset": bson.M{"locked_by": "", "locked_until": ""}})
+		recordDBTime(c, "updateOne", bson.M{"_id": id}, start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to unlock student"})
+			return
+		}
+
+		if result.MatchedCount == 0 {
+			// Either there is no such student, it isn't locked, or someone
+			// else holds the lock.
+			held, err := findLock(c, coll, id)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+				return
+			}
+			if err != nil {
+				dbError(c, err, gin.H{"error": "Failed to fetch document"})
+				return
+			}
+			if held.heldByOther(owner, time.Now()) {
+				lockConflict(c, held)
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"id": id, "unlocked": false})
+			return
+		}
+
+		recordAudit(c, "unlock", id, bson.M{"force": force})
+
+		c.JSON(http.StatusOK, gin.H{"id": id, "unlocked": true})
+	}
+}
+
+// honorLocks makes the writes under /students/:id respect locks when
+// HONOR_LOCKS is on: a write to a student someone else holds a live lock
+// on is a 409, while the holder, naming itself in X-Editor, and writes to
+// unlocked students go through. It checks before the write rather than in the write's own
+// filter, so it guards against editors overwriting each other, not against
+// a race in the same instant. Writes that select students in bulk use
+// writable and findLocked instead.
+func honorLocks(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if m := c.Request.Method; m == http.MethodGet || m == http.MethodHead || strings.HasSuffix(c.FullPath(), "/lock") {
+			c.Next()
+			return
+		}
+		coll := tenantColl(c, coll)
+
+		held, err := findLock(c, coll, studentID(c))
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.Next() // the handler answers 404
+			return
+		}
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to check lock"})
+			c.Abort()
+			return
+		}
+		if held.heldByOther(callerEditor(c), time.Now()) {
+			lockConflict(c, held)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCallerEditor(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "secret")
+
+	tests := []struct {
+		name   string
+		auth   string
+		editor string
+		want   string
+	}{
+		{name: "admin editor", auth: "Bearer secret", editor: " alice ", want: "alice"},
+		{name: "admin without editor", auth: "Bearer secret", want: ""},
+		{name: "editor without admin key", editor: "alice", want: ""},
+		{name: "editor with wrong key", auth: "Bearer wrong", editor: "alice", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+			if tt.auth != "" {
+				c.Request.Header.Set("Authorization", tt.auth)
+			}
+			if tt.editor != "" {
+				c.Request.Header.Set(editorHeader, tt.editor)
+			}
+			if got := callerEditor(c); got != tt.want {
+				t.Errorf("callerEditor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeldByOther(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	live := studentLock{LockedBy: "alice", LockedUntil: now.Add(time.Minute)}
+	expired := studentLock{LockedBy: "alice", LockedUntil: now.Add(-time.Minute)}
+
+	tests := []struct {
+		name  string
+		lock  studentLock
+		owner string
+		want  bool
+	}{
+		{name: "holder", lock: live, owner: "alice", want: false},
+		{name: "other editor", lock: live, owner: "bob", want: true},
+		{name: "no editor", lock: live, owner: "", want: true},
+		{name: "expired", lock: expired, owner: "bob", want: false},
+		{name: "unlocked", lock: studentLock{}, owner: "bob", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.lock.heldByOther(tt.owner, now); got != tt.want {
+				t.Errorf("heldByOther(%q) = %v, want %v", tt.owner, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLockContention has two editors sharing the admin key contend for one
+// lock. It needs MongoDB in MONGODB_URI or the MONGO_* variables, and is
+// skipped without it.
+func TestLockContention(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	conn, err := connectMongo(ctx, "")
+	if err != nil {
+		t.Skipf("no MongoDB: %v", err)
+	}
+	defer conn.client.Disconnect(context.Background())
+
+	coll := conn.db.Collection(fmt.Sprintf("lock_test_%s", primitive.NewObjectID().Hex()))
+	defer coll.Drop(context.Background())
+	res, err := coll.InsertOne(ctx, bson.M{"name": "Ann"})
+	if err != nil {
+		t.Fatalf("InsertOne error = %v", err)
+	}
+
+	// Requests resolve their collection from the live connection; leaving
+	// out the audit collection keeps the test from writing audit entries.
+	prev := liveConn.Load()
+	liveConn.Store(&mongoConn{client: conn.client, db: conn.db, students: coll})
+	defer liveConn.Store(prev)
+
+	t.Setenv("ADMIN_API_KEY", "secret")
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	byID := r.Group("/students/:id", parseIDParam())
+	byID.POST("/lock", authRequired(), lockHandler(coll))
+	byID.DELETE("/lock", authRequired(), unlockHandler(coll))
+
+	path := "/students/" + res.InsertedID.(primitive.ObjectID).Hex() + "/lock"
+	send := func(method, editor string) (int, gin.H) {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		if editor != "" {
+			req.Header.Set(editorHeader, editor)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body gin.H
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	steps := []struct {
+		method, editor string
+		wantCode       int
+		wantHolder     string
+	}{
+		{method: http.MethodPost, editor: "", wantCode: http.StatusBadRequest},
+		{method: http.MethodPost, editor: "alice", wantCode: http.StatusOK, wantHolder: "alice"},
+		{method: http.MethodPost, editor: "bob", wantCode: http.StatusConflict, wantHolder: "alice"},
+		{method: http.MethodDelete, editor: "bob", wantCode: http.StatusConflict, wantHolder: "alice"},
+		{method: http.MethodPost, editor: "alice", wantCode: http.StatusOK, wantHolder: "alice"},
+		{method: http.MethodDelete, editor: "alice", wantCode: http.StatusOK},
+		{method: http.MethodPost, editor: "bob", wantCode: http.StatusOK, wantHolder: "bob"},
+	}
+	for i, st := range steps {
+		code, body := send(st.method, st.editor)
+		if code != st.wantCode {
+			t.Fatalf("step %d: %s as %q = %d %v, want %d", i, st.method, st.editor, code, body, st.wantCode)
+		}
+		if st.wantHolder != "" && body["lockedBy"] != st.wantHolder {
+			t.Errorf("step %d: %s as %q lockedBy = %v, want %s", i, st.method, st.editor, body["lockedBy"], st.wantHolder)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Log levels, lowest first. LOG_LEVEL may be reloaded on SIGHUP.
+const (
+	levelDebug int32 = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevel atomic.Int32
+
+func init() {
+	logLevel.Store(levelInfo)
+}
+
+// parseLogLevel maps a LOG_LEVEL value to a level, defaulting to info.
+func parseLogLevel(v string) int32 {
+	switch strings.ToLower(v) {
+	case "debug":
+		return levelDebug
+	case "warn", "warning":
+		return levelWarn
+	case "error":
+		return levelError
+	case "", "info":
+		return levelInfo
+	}
+	log.Printf("Invalid LOG_LEVEL=%q, using info", v)
+	return levelInfo
+}
+
+// warnf logs at WARN level.
+func warnf(format string, args ...interface{}) {
+	if logLevel.Load() <= levelWarn {
+		log.Printf("WARN "+format, args...)
+	}
+}
+
+// requestLogger is gin's access log, silenced when LOG_LEVEL is above info.
+// It also counts 4xx/5xx responses per route for GET /stats/errors.
+func requestLogger() gin.HandlerFunc {
+	logger := gin.Logger()
+	return func(c *gin.Context) {
+		if logLevel.Load() > levelInfo {
+			c.Next()
+		} else {
+			logger(c)
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = "<unmatched>"
+		}
+		routeErrors.record(c.Request.Method+" "+route, c.Writer.Status())
+	}
+}
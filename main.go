@@ -2,124 +2,1515 @@ package main
 
 import (
 	"context"
+	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-var collection *mongo.Collection
+// collection and alumniCollection are the handles routes are registered
+// with. They stand for the students and alumni collections: requests
+// resolve the live ones, of their tenant and current connection, through
+// tenantColl.
+var (
+	collection       *mongo.Collection
+	alumniCollection *mongo.Collection
+)
 
-// Struct for students
+// Struct for students. Courses references documents in the courses
+// collection by _id. ID holds the stored _id (an ObjectID, or a string when
+// CUSTOM_IDS is on) and is left out of JSON; clients propose a custom id
+// through CustomID ("id") on create. JSON responses are rendered from the
+// stored documents instead, by renderDocs; the json tags name fields the
+// way JSON_NAMING=camel presents them.
 type Student struct {
-	Name string `json:"name" bson:"name"`
-	Age  int    `json:"age"  bson:"age"`
+	XMLName       xml.Name             `json:"-"             form:"-"      bson:"-"                        xml:"student"`
+	ID            interface{}          `json:"-"             form:"-"      bson:"_id,omitempty"            xml:"id,attr"`
+	CustomID      string               `json:"id"            form:"id"     bson:"-"                        xml:"-"`
+	Name          string               `json:"name"          form:"name"   bson:"name"                     xml:"name"`
+	Age           Age                  `json:"age"           form:"age"    bson:"age"                      xml:"age"`
+	Email         string               `json:"email"         form:"email"  bson:"email,omitempty"          xml:"email,omitempty"`
+	Courses       []primitive.ObjectID `json:"courses"       form:"-"      bson:"courses,omitempty"        xml:"courses>course"`
+	Position      int                  `json:"position"      form:"-"      bson:"position,omitempty"       xml:"position"`
+	Active        *bool                `json:"active"        form:"active" bson:"active"                   xml:"active"`
+	Tags          []string             `json:"tags"          form:"tags"   bson:"tags,omitempty"           xml:"tags>tag"`
+	StudentNumber int64                `json:"studentNumber" form:"-"      bson:"student_number,omitempty" xml:"student_number,omitempty"`
+	CreatedAt     time.Time            `json:"createdAt"     form:"-"      bson:"created_at"               xml:"created_at"`
+	UpdatedAt     time.Time            `json:"updatedAt"     form:"-"      bson:"updated_at"               xml:"updated_at"`
+}
+
+// prepareInsert sets the server-managed fields on a new student: an _id
+// unless a custom one was given, both timestamps, and Active defaulting to
+// true when the client didn't say. Choosing the _id here rather than in
+// the driver means a retried insert can't store the student twice. A
+// StudentNumber sent by the client is dropped; the caller assigns one with
+// reserveStudentNumbers.
+func (s *Student) prepareInsert(now time.Time) {
+	if s.ID == nil {
+		s.ID = primitive.NewObjectID()
+	}
+	s.CreatedAt = now
+	s.UpdatedAt = now
+	s.StudentNumber = 0
+	if s.Active == nil {
+		active := true
+		s.Active = &active
+	}
+}
+
+// insertDoc is the document actually stored for a new student. It lists
+// the persisted fields explicitly, so a field added to Student for the API
+// is not written to Mongo until it is added here too. Call prepareInsert
+// first. Optional fields are left out rather than stored as zero values.
+func (s *Student) insertDoc() bson.D {
+	var doc bson.D
+	if s.ID != nil {
+		doc = append(doc, bson.E{Key: "_id", Value: s.ID})
+	}
+	doc = append(doc,
+		bson.E{Key: "name", Value: s.Name},
+		bson.E{Key: "age", Value: s.Age},
+	)
+	if s.Email != "" {
+		doc = append(doc, bson.E{Key: "email", Value: s.Email})
+	}
+	if len(s.Courses) > 0 {
+		doc = append(doc, bson.E{Key: "courses", Value: s.Courses})
+	}
+	if s.Position != 0 {
+		doc = append(doc, bson.E{Key: "position", Value: s.Position})
+	}
+	if s.Active != nil {
+		doc = append(doc, bson.E{Key: "active", Value: *s.Active})
+	}
+	if len(s.Tags) > 0 {
+		doc = append(doc, bson.E{Key: "tags", Value: s.Tags})
+	}
+	if s.StudentNumber != 0 {
+		doc = append(doc, bson.E{Key: "student_number", Value: s.StudentNumber})
+	}
+	return append(doc,
+		bson.E{Key: "created_at", Value: s.CreatedAt},
+		bson.E{Key: "updated_at", Value: s.UpdatedAt},
+	)
+}
+
+// StudentUpdate is the PATCH body; nil fields are left unchanged.
+type StudentUpdate struct {
+	Name  *string `json:"name"`
+	Age   *Age    `json:"age"`
+	Email *string `json:"email"`
+}
+
+// setFields returns the $set document for the fields present in u.
+func (u StudentUpdate) setFields() bson.M {
+	set := bson.M{}
+	if u.Name != nil {
+		set["name"] = *u.Name
+	}
+	if u.Age != nil {
+		set["age"] = *u.Age
+	}
+	if u.Email != nil {
+		set["email"] = *u.Email
+	}
+	return set
+}
+
+// unsettableFields are the fields PATCH ?unset= may remove. Name and age
+// are required, so they can be changed but never cleared.
+var unsettableFields = map[string]bool{"email": true}
+
+// parseUnset reads ?unset=email as the list of fields to remove. A field
+// cannot be both set by the body and unset.
+func parseUnset(param string, set bson.M) ([]string, error) {
+	var unset []string
+	for _, field := range strings.Split(param, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !unsettableFields[field] {
+			return nil, fmt.Errorf("cannot unset %q", field)
+		}
+		if _, ok := set[field]; ok {
+			return nil, fmt.Errorf("%q cannot be both set and unset", field)
+		}
+		unset = append(unset, field)
+	}
+	return unset, nil
 }
 
 func main() {
+	selfTest := flag.Bool("selftest", false, "verify MongoDB read/write access and exit")
+	flag.Parse()
+
 	// Load .env file for local dev (Render will skip this)
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using Render environment variables")
 	}
 
+	cfg = loadConfig()
+	logLevel.Store(parseLogLevel(os.Getenv("LOG_LEVEL")))
+
 	fmt.Println("Main package -> PORT:", os.Getenv("PORT"))
 
-	// MongoDB URI
-	uri := os.Getenv("MONGODB_URI")
-	if uri == "" {
-		log.Fatal("You must set MONGODB_URI environment variable")
-	}
+	// Post-deploy smoke check: --selftest or SELFTEST=true
+	runSelfTestOnly := *selfTest || envBool("SELFTEST", false)
 
-	// MongoDB client
-	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
-	clientOptions := options.Client().ApplyURI(uri).SetServerAPIOptions(serverAPI)
+	// ✅ Run on Render-provided PORT
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080" // local fallback
+	}
 
-	client, err := mongo.Connect(context.TODO(), clientOptions)
-	if err != nil {
-		log.Fatal("MongoDB connection error:", err)
+	// Listen right away; the gate answers 503 until startup has finished.
+	gate := &startupGate{}
+	srv := &http.Server{Addr: ":" + port, Handler: gate}
+	if !runSelfTestOnly {
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal("Server error: ", err)
+			}
+		}()
 	}
 
+	// MongoDB client & collections
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	if err := client.Ping(ctx, readpref.Primary()); err != nil {
-		log.Fatal("MongoDB ping failed:", err)
+	conn, err := connectMongo(ctx, cfg.WriteConcern)
+	if errors.Is(err, errNoMongoURI) {
+		log.Fatal("You must set MONGODB_URI, or MONGO_HOST, MONGO_USER, MONGO_PASSWORD and MONGO_DB")
+	}
+	if err != nil {
+		log.Fatal("MongoDB ", err)
 	}
 
 	fmt.Println("Pinged your deployment. You successfully connected to MongoDB!")
+	dbHealthy.Store(true)
+
+	createOpts, err := parseCollectionOpts(cfg.CollectionOpts)
+	if err != nil {
+		log.Fatal("CREATE_COLLECTION_OPTS: ", err)
+	}
+	if err := ensureCollection(ctx, conn.db, "theirdata", createOpts); err != nil {
+		log.Fatal("Failed to create collection: ", err)
+	}
+
+	liveConn.Store(conn)
+	collection = conn.students
+	alumniCollection = conn.alumni
+
+	if err := ensureIndexes(ctx, collection); err != nil {
+		log.Println("Failed to create indexes:", err)
+	}
+	if err := ensureAuditIndexes(ctx, conn.audit); err != nil {
+		log.Println("Failed to create audit indexes:", err)
+	}
+	if err := ensureTombstoneIndexes(ctx, conn.db.Collection(tombstonesCollection)); err != nil {
+		log.Println("Failed to create tombstone indexes:", err)
+	}
 
-	// Database & collection
-	db := client.Database("students")
-	collection = db.Collection("theirdata")
+	if runSelfTestOnly {
+		if err := runSelfTest(collection); err != nil {
+			log.Fatal("selftest failed: ", err)
+		}
+		log.Println("selftest passed")
+		return
+	}
 
 	// Gin router
-	r := gin.Default()
+	r := gin.New()
+	r.Use(requestIDMiddleware(), requestLogger(), gin.Recovery())
+
+	// Security headers and the HTTPS redirect (SECURITY_HEADERS, FORCE_HTTPS)
+	r.Use(secureMiddleware(cfg.SecurityHeaders, cfg.ForceHTTPS))
+
+	// CORS (CORS_ALLOWED_ORIGINS, defaults to localhost for dev + the Render domain)
+	corsMiddleware := &swappableHandler{}
+	corsHandler, err := newCORS(corsConfig())
+	if err != nil {
+		log.Printf("Invalid CORS config (%v), using the default origins", err)
+		fallback := corsConfig()
+		fallback.AllowOrigins = defaultCORSOrigins
+		fallback.AllowCredentials = true
+		corsHandler = cors.New(fallback)
+	}
+	corsMiddleware.set(corsHandler)
+	r.Use(corsMiddleware.handle)
+
+	// Client IPs come from X-Forwarded-For only behind TRUSTED_PROXIES, so
+	// callers can't pick their own rate limit bucket.
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Printf("Invalid TRUSTED_PROXIES (%v), trusting no proxies", err)
+		r.SetTrustedProxies(nil)
+	}
 
-	// CORS (allow localhost for dev + your Render domain in production)
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:5173", "https://your-render-service.onrender.com"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Origin", "Content-Type"},
-		AllowCredentials: true,
-	}))
+	// Per-IP rate limiting (admin API key callers are exempt)
+	limiter := newRateLimiter(float64(cfg.RateLimitRPS), cfg.RateLimitBurst)
+	r.Use(rateLimit(limiter))
 
-	// GET /students
-	r.GET("/students", func(c *gin.Context) {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// LOG_LEVEL, rate limits and CORS can be reloaded with SIGHUP
+	reloadOnSIGHUP(limiter, corsMiddleware)
+
+	// Cap in-flight requests to protect MongoDB during spikes
+	r.Use(limitConcurrency(cfg.MaxConcurrent, cfg.ConcurrencyWait))
+
+	// Replay protection for writes (REQUEST_MAX_SKEW, off by default)
+	if cfg.RequestMaxSkew > 0 {
+		r.Use(requireFresh(cfg.RequestMaxSkew))
+	}
+
+	// Per-route DB timeouts (ROUTE_TIMEOUTS, REQUEST_TIMEOUT)
+	r.Use(applyTimeouts(cfg.RouteTimeouts, cfg.RequestTimeout))
+
+	// ?tz= renders timestamps in an IANA zone; 400 for unknown names
+	r.Use(parseTimezone())
+
+	// 503 instead of a nil-pointer panic if the collection isn't set up
+	r.Use(requireDB())
+
+	// Per-tenant students_<id>/alumni_<id> collections (TENANTS, off by default)
+	if len(cfg.Tenants) > 0 {
+		r.Use(resolveTenant(newTenantRegistry(cfg.Tenants, createOpts), cfg.TenantHeader))
+	}
+
+	// Last-Modified on GET /students reflects every write, hard deletes included
+	r.Use(trackMutations())
+
+	// X-Debug-Timing support (dev only)
+	if cfg.Env != "production" {
+		r.Use(debugTiming())
+	}
+
+	// GET /students, HEAD /students (JSON, CSV, XML or compact via Accept or ?format=)
+	listFormats := negotiate(mimeJSON, envelopeMediaType, mimeCSV, mimeXML, mimeCompact)
+	itemFormats := negotiate(mimeJSON, envelopeMediaType, mimeXML)
+	r.GET("/students", listFormats, listHandler(collection))
+	r.HEAD("/students", listHandler(collection))
+
+	// GET /students/export.csv (?skip=&limit= to export in pages)
+	r.GET("/students/export.csv", exportCSVHandler(collection))
+
+	// GET /students/export.xlsx (same params as the CSV export)
+	r.GET("/students/export.xlsx", exportXLSXHandler(collection))
+
+	// GET /students.ndjson (JSON Lines, streamed)
+	r.GET("/students.ndjson", exportNDJSONHandler(collection))
+
+	// GET /students/changes?since= (delta sync)
+	r.GET("/students/changes", changesHandler(collection))
+
+	// GET /students/recent?since= (created since, by ObjectID time)
+	r.GET("/students/recent", recentHandler(collection))
+
+	// GET /students/preview?filter=&sample= (match count + first matches, read-only)
+	r.GET("/students/preview", previewHandler(collection))
+
+	// GET /students/schema?sample= (field names and BSON types seen in a sample)
+	r.GET("/students/schema", schemaHandler(collection))
+
+	// GET /students/stream (Server-Sent Events of inserts/updates/deletes)
+	r.GET("/students/stream", streamHandler(collection))
+
+	// GET /alumni
+	r.GET("/alumni", listFormats, listHandler(alumniCollection))
+
+	// GET /students/group-by/:field (counts per value, most common first)
+	r.GET("/students/group-by/:field", groupByHandler(collection))
+
+	// GET /students/by-name?afterName=&afterId= (keyset pagination in name order)
+	r.GET("/students/by-name", byNameHandler(collection))
+
+	// GET /students/near-age?age=&count= (closest ages first)
+	r.GET("/students/near-age", nearAgeHandler(collection))
+
+	// GET /students/age-percentiles (25th/50th/75th/90th)
+	r.GET("/students/age-percentiles", agePercentilesHandler(collection))
+
+	// GET /students/count-by-age
+	r.GET("/students/count-by-age", func(c *gin.Context) {
+		ctx, cancel := dbContext(c, 10*time.Second)
 		defer cancel()
 
-		cursor, err := collection.Find(ctx, bson.D{})
+		pipeline := mongo.Pipeline{
+			liveStage,
+			{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: "$age"},
+				{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			}}},
+			{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+			{{Key: "$project", Value: bson.D{
+				{Key: "_id", Value: 0},
+				{Key: "age", Value: "$_id"},
+				{Key: "count", Value: 1},
+			}}},
+		}
+
+		start := time.Now()
+		cursor, err := studentsColl(c).Aggregate(ctx, pipeline)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch documents"})
+			dbError(c, err, gin.H{"error": "Failed to aggregate documents"})
 			return
 		}
 		defer cursor.Close(ctx)
 
-		var results []bson.M
-		if err := cursor.All(ctx, &results); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode documents"})
+		results := []bson.M{}
+		err = cursor.All(ctx, &results)
+		recordDBTime(c, "aggregate", "group by age", start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to decode documents"})
+			return
+		}
+
+		respond(c, http.StatusOK, results, gin.H{"count": len(results)})
+	})
+
+	// GET /students/duplicates?by=name|email lists values shared by more than one student.
+	// The values are the grouped field, so by=email needs a caller allowed to see email.
+	r.GET("/students/duplicates", func(c *gin.Context) {
+		field := c.DefaultQuery("by", "name")
+		if field != "name" && field != "email" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "by must be name or email"})
+			return
+		}
+		if !canSee(c, field) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "by=" + field + " requires the admin API key"})
+			return
+		}
+
+		ctx, cancel := dbContext(c, 10*time.Second)
+		defer cancel()
+
+		pipeline := mongo.Pipeline{
+			{{Key: "$match", Value: live(bson.M{field: bson.M{"$nin": bson.A{nil, ""}}})}},
+			{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: "$" + field},
+				{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+				{Key: "ids", Value: bson.D{{Key: "$push", Value: "$_id"}}},
+			}}},
+			{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+			{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+			{{Key: "$project", Value: bson.D{
+				{Key: "_id", Value: 0},
+				{Key: "value", Value: "$_id"},
+				{Key: "count", Value: 1},
+				{Key: "ids", Value: 1},
+			}}},
+		}
+
+		// Names group under the name index's collation, so names that
+		// differ only by case show up as duplicates too.
+		opts := options.Aggregate()
+		if field == "name" {
+			opts.SetCollation(nameCollation)
+		}
+
+		start := time.Now()
+		cursor, err := studentsColl(c).Aggregate(ctx, pipeline, opts)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to aggregate documents"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		groups := []bson.M{}
+		err = cursor.All(ctx, &groups)
+		recordDBTime(c, "aggregate", "duplicates by "+field, start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to decode documents"})
+			return
+		}
+
+		respond(c, http.StatusOK, groups, gin.H{"by": field, "count": len(groups)})
+	})
+
+	// GET /students/name-available?name= (case-insensitive, briefly cached)
+	r.GET("/students/name-available", nameAvailableHandler(collection))
+
+	// GET /students/search?q= matches q case-insensitively against name and
+	// email. Email is only searched for callers allowed to see it.
+	r.GET("/students/search", func(c *gin.Context) {
+		q := strings.TrimSpace(c.Query("q"))
+		if q == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+			return
+		}
+
+		limit, skip, err := parsePagination(c.Query("limit"), c.Query("skip"), cfg.MaxPageSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := dbContext(c, 10*time.Second)
+		defer cancel()
+
+		// A single $or query returns each student once even if several
+		// fields match.
+		results, total, err := regexSearch(ctx, c, studentsColl(c), q, limit, skip)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch documents"})
+			return
+		}
+
+		maskFields(c, results...)
+		c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+		respond(c, http.StatusOK, results, gin.H{"q": q, "limit": limit, "skip": skip, "count": len(results), "total": total})
+	})
+
+	// GET /students/text-search?q= (relevance-ranked, see textSearchHandler)
+	r.GET("/students/text-search", textSearchHandler(collection))
+
+	// GET /students/extremes
+	r.GET("/students/extremes", func(c *gin.Context) {
+		ctx, cancel := dbContext(c, 10*time.Second)
+		defer cancel()
+
+		// findByAge returns the first student in the given age order, or nil
+		// when the collection is empty.
+		findByAge := func(order int) (bson.M, error) {
+			opts := options.FindOne().SetSort(bson.D{{Key: "age", Value: order}})
+
+			var student bson.M
+			err := studentsColl(c).FindOne(ctx, live(nil), opts).Decode(&student)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, nil
+			}
+			return student, err
+		}
+
+		start := time.Now()
+		oldest, err := findByAge(-1)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch documents"})
+			return
+		}
+
+		youngest, err := findByAge(1)
+		recordDBTime(c, "findOne", "oldest and youngest", start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch documents"})
 			return
 		}
 
-		c.JSON(http.StatusOK, results)
+		maskFields(c, oldest, youngest)
+		respond(c, http.StatusOK, gin.H{"oldest": oldest, "youngest": youngest}, nil)
 	})
 
-	// POST /students
+	// POST /students (JSON or form-encoded)
 	r.POST("/students", func(c *gin.Context) {
 		var newStudent Student
-		if err := c.ShouldBindJSON(&newStudent); err != nil {
+		if err := bindBody(c, &newStudent); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		if newStudent.CustomID != "" {
+			if !cfg.CustomIDs {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Custom ids are not enabled"})
+				return
+			}
+			if !validCustomID(newStudent.CustomID) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "id must be 1-64 letters, digits, '_' or '-' and not a 24-char hex string"})
+				return
+			}
+			newStudent.ID = newStudent.CustomID
+		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctx, cancel := dbContext(c, 5*time.Second)
 		defer cancel()
 
-		result, err := collection.InsertOne(ctx, newStudent)
+		start := time.Now()
+		problems, err := validateStudent(ctx, studentsColl(c), newStudent)
+		recordDBTime(c, "countDocuments", "uniqueness", start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to validate document"})
+			return
+		}
+		if len(problems) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"valid": false, "errors": problems})
+			return
+		}
+
+		newStudent.prepareInsert(time.Now().UTC())
+
+		start = time.Now()
+		newStudent.StudentNumber, err = reserveStudentNumbers(ctx, studentsColl(c), 1)
+		recordDBTime(c, "findOneAndUpdate", "next student number", start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to assign student number"})
+			return
+		}
+
+		// The _id is set before the first attempt, so a retry that finds it
+		// taken means an earlier attempt that reported failure did land.
+		start = time.Now()
+		doc := newStudent.insertDoc()
+		attempts := 0
+		err = retryWrite(ctx, c, "insertOne", func() error {
+			attempts++
+			_, err := studentsColl(c).InsertOne(ctx, doc)
+			if attempts > 1 && isDuplicateID(err) {
+				return nil
+			}
+			return err
+		})
+		recordDBTime(c, "insertOne", "", start)
+		if msg := duplicateMessage(err); msg != "" {
+			c.JSON(http.StatusConflict, gin.H{"error": msg})
+			return
+		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert document"})
+			dbError(c, err, gin.H{"error": "Failed to insert document"})
 			return
 		}
 
+		recordAudit(c, "create", newStudent.ID, bson.M{"name": newStudent.Name, "age": newStudent.Age, "email": newStudent.Email})
+
+		// Point clients at the new resource (served by GET /students/:id).
+		c.Header("Location", "/students/"+idString(newStudent.ID))
 		c.JSON(http.StatusCreated, gin.H{
-			"message":    "Student added successfully!",
-			"insertedID": result.InsertedID,
+			"message":       "Student added successfully!",
+			"insertedID":    newStudent.ID,
+			"studentNumber": newStudent.StudentNumber,
 		})
 	})
 
-	// ✅ Run on Render-provided PORT
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080" // local fallback
+	// POST /students/validate runs the POST /students checks without inserting.
+	// It binds the body the same way, so form posts are accepted too.
+	r.POST("/students/validate", func(c *gin.Context) {
+		var student Student
+		if err := bindBody(c, &student); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"valid": false, "errors": []string{err.Error()}})
+			return
+		}
+
+		ctx, cancel := dbContext(c, 5*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		problems, err := validateStudent(ctx, studentsColl(c), student)
+		recordDBTime(c, "countDocuments", "uniqueness", start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to validate document"})
+			return
+		}
+		if len(problems) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"valid": false, "errors": problems})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"valid": true})
+	})
+
+	// POST /students/merge (admin) folds "ids" into "primaryId" and deletes them
+	r.POST("/students/merge", authRequired(), func(c *gin.Context) {
+		var req struct {
+			PrimaryID string   `json:"primaryId" binding:"required"`
+			IDs       []string `json:"ids"       binding:"required,min=1"`
+		}
+		if err := bindJSON(c, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		primaryID, err := primitive.ObjectIDFromHex(req.PrimaryID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid primaryId"})
+			return
+		}
+		otherIDs := make([]interface{}, 0, len(req.IDs))
+		for _, hex := range req.IDs {
+			id, err := primitive.ObjectIDFromHex(hex)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID: " + hex})
+				return
+			}
+			otherIDs = append(otherIDs, id)
+		}
+
+		ctx, cancel := dbContext(c, 15*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		merged, mergedIDs, err := mergeStudents(ctx, studentsColl(c), primaryID, otherIDs, false, callerEditor(c))
+		recordDBTime(c, "merge", bson.M{"_id": primaryID}, start)
+		if errors.Is(err, errStudentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+			return
+		}
+		var locked errLocked
+		if errors.As(err, &locked) {
+			lockConflict(c, locked.lock)
+			return
+		}
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to merge students"})
+			return
+		}
+
+		recordAudit(c, "merge", primaryID, bson.M{"merged": mergedIDs})
+
+		renderDocs(c, merged)
+		c.JSON(http.StatusOK, gin.H{
+			"primaryId":   primaryID,
+			"mergedIds":   mergedIDs,
+			"mergedCount": len(mergedIDs),
+			"student":     merged,
+		})
+	})
+
+	// GET /students/by-name/:name returns the first student (oldest _id) with
+	// exactly that name. GET /students?name= is a case-insensitive substring
+	// match, so it also lists students whose names merely contain this one.
+	// Gin hands us the path param already URL-decoded.
+	r.GET("/students/by-name/:name", itemFormats, func(c *gin.Context) {
+		name := c.Param("name")
+
+		ctx, cancel := dbContext(c, 5*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		var student bson.M
+		opts := options.FindOne().SetSort(bson.D{{Key: "_id", Value: 1}})
+		err := studentsColl(c).FindOne(ctx, live(bson.M{"name": name}), opts).Decode(&student)
+		recordDBTime(c, "findOne", bson.M{"name": name}, start)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+			return
+		}
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch document"})
+			return
+		}
+
+		maskFields(c, student)
+		respondItem(c, http.StatusOK, student)
+	})
+
+	// Routes under /students/:id get the parsed id from parseIDParam.
+	byID := r.Group("/students/:id", parseIDParam())
+
+	// Writes by id respect POST /students/:id/lock (HONOR_LOCKS, off by default)
+	if cfg.HonorLocks {
+		byID.Use(honorLocks(collection))
+	}
+
+	// GET /students/:id (?expand=courses embeds the referenced course documents)
+	byID.GET("", itemFormats, func(c *gin.Context) {
+		id := studentID(c)
+
+		ctx, cancel := dbContext(c, 5*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		var student bson.M
+		var err error
+		if c.Query("expand") == "courses" {
+			pipeline := mongo.Pipeline{
+				{{Key: "$match", Value: live(bson.M{"_id": id})}},
+				{{Key: "$lookup", Value: bson.D{
+					{Key: "from", Value: "courses"},
+					{Key: "localField", Value: "courses"},
+					{Key: "foreignField", Value: "_id"},
+					{Key: "as", Value: "courses"},
+				}}},
+			}
+
+			var cursor *mongo.Cursor
+			cursor, err = studentsColl(c).Aggregate(ctx, pipeline)
+			if err == nil {
+				defer cursor.Close(ctx)
+				if cursor.Next(ctx) {
+					err = cursor.Decode(&student)
+				} else if err = cursor.Err(); err == nil {
+					err = mongo.ErrNoDocuments
+				}
+			}
+		} else {
+			err = studentsColl(c).FindOne(ctx, live(bson.M{"_id": id})).Decode(&student)
+		}
+		recordDBTime(c, "findOne", bson.M{"_id": id}, start)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+			return
+		}
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch document"})
+			return
+		}
+
+		maskFields(c, student)
+		respondItem(c, http.StatusOK, student)
+	})
+
+	// POST /students/bulk inserts many students; failures are reported per document.
+	// Documents failing the POST /students field checks are reported without
+	// being sent. ?fastWrite=true trades durability for speed (w:1).
+	r.POST("/students/bulk", func(c *gin.Context) {
+		var students []Student
+		if err := bindJSON(c, &students); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(students) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No students provided"})
+			return
+		}
+		if int64(len(students)) > cfg.MaxBatchSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d students per request", cfg.MaxBatchSize)})
+			return
+		}
+
+		failed := map[int]string{}
+		var valid []int // indexes into students of the documents sent
+		for i := range students {
+			if problems := checkStudentFields(students[i]); len(problems) > 0 {
+				failed[i] = strings.Join(problems, "; ")
+				continue
+			}
+			valid = append(valid, i)
+		}
+
+		ctx, cancel := dbContext(c, 30*time.Second)
+		defer cancel()
+
+		insertedIDs := map[int]interface{}{}
+		if len(valid) > 0 {
+			start := time.Now()
+			first, err := reserveStudentNumbers(ctx, studentsColl(c), len(valid))
+			recordDBTime(c, "findOneAndUpdate", "next student numbers", start)
+			if err != nil {
+				dbError(c, err, gin.H{"error": "Failed to assign student numbers"})
+				return
+			}
+
+			now := time.Now().UTC()
+			docs := make([]interface{}, len(valid))
+			for k, i := range valid {
+				students[i].prepareInsert(now)
+				students[i].StudentNumber = first + int64(k)
+				docs[k] = students[i].insertDoc()
+			}
+
+			// Unordered so one bad document doesn't stop the rest.
+			start = time.Now()
+			coll := fastWrites(studentsColl(c), c.Query("fastWrite") == "true")
+			result, err := coll.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+			recordDBTime(c, "insertMany", "", start)
+
+			var bulkErr mongo.BulkWriteException
+			if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+				for _, we := range bulkErr.WriteErrors {
+					failed[valid[we.Index]] = we.Message
+				}
+			} else if err != nil {
+				dbError(c, err, gin.H{"error": "Failed to insert documents"})
+				return
+			}
+			for k, i := range valid {
+				if _, ok := failed[i]; !ok {
+					insertedIDs[i] = result.InsertedIDs[k]
+				}
+			}
+		}
+
+		results := make([]gin.H, len(students))
+		inserted := 0
+		for i := range students {
+			if msg, ok := failed[i]; ok {
+				results[i] = gin.H{"index": i, "status": "failed", "error": msg}
+				continue
+			}
+			inserted++
+			results[i] = gin.H{"index": i, "status": "inserted", "insertedID": insertedIDs[i], "studentNumber": students[i].StudentNumber}
+			recordAudit(c, "create", insertedIDs[i], bson.M{"name": students[i].Name, "age": students[i].Age, "email": students[i].Email})
+		}
+
+		status := http.StatusCreated
+		if len(failed) > 0 {
+			status = http.StatusMultiStatus
+		}
+		c.JSON(status, gin.H{"inserted": inserted, "failed": len(failed), "results": results})
+	})
+
+	// POST /students/upsert (array, matched by email; inserted/updated counts)
+	r.POST("/students/upsert", upsertHandler(collection))
+
+	// GET /students/:id/history lists the audit entries for a student, oldest first.
+	// Who made each change (actor, ip) is only shown to admins.
+	byID.GET("/history", func(c *gin.Context) {
+		id := studentID(c)
+
+		limit, skip, err := parsePagination(c.Query("limit"), c.Query("skip"), cfg.MaxPageSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := dbContext(c, 10*time.Second)
+		defer cancel()
+
+		// Tenants share the audit collection, and ids are only unique
+		// within a tenant. A nil tenant matches entries without one.
+		filter := bson.M{"target_id": id, "tenant": nil}
+		if tenant := requestTenant(c); tenant != "" {
+			filter["tenant"] = tenant
+		}
+		start := time.Now()
+		total, err := auditColl().CountDocuments(ctx, filter)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to count history"})
+			return
+		}
+
+		// No history and no student means the id is simply unknown.
+		if total == 0 {
+			n, err := studentsColl(c).CountDocuments(ctx, live(bson.M{"_id": id}), options.Count().SetLimit(1))
+			if err != nil {
+				dbError(c, err, gin.H{"error": "Failed to fetch document"})
+				return
+			}
+			if n == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+				return
+			}
+		}
+
+		opts := options.Find().
+			SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}).
+			SetLimit(limit).
+			SetSkip(skip)
+		cursor, err := auditColl().Find(ctx, filter, opts)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch history"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		entries := []AuditEntry{}
+		err = cursor.All(ctx, &entries)
+		recordDBTime(c, "find", filter, start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to decode history"})
+			return
+		}
+
+		admin := callerRole(c) == "admin"
+		for i := range entries {
+			maskFields(c, entries[i].Changes)
+			if !admin {
+				entries[i].Actor, entries[i].IP = "", ""
+			}
+		}
+		c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+		respond(c, http.StatusOK, entries, gin.H{"limit": limit, "skip": skip, "count": len(entries), "total": total})
+	})
+
+	// GET /students/:id/courses returns just the student's course ids
+	byID.GET("/courses", func(c *gin.Context) {
+		id := studentID(c)
+
+		ctx, cancel := dbContext(c, 5*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		var student struct {
+			Courses []primitive.ObjectID `bson:"courses"`
+		}
+		opts := options.FindOne().SetProjection(bson.M{"courses": 1})
+		err := studentsColl(c).FindOne(ctx, live(bson.M{"_id": id}), opts).Decode(&student)
+		recordDBTime(c, "findOne", bson.M{"_id": id}, start)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+			return
+		}
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch document"})
+			return
+		}
+
+		if student.Courses == nil {
+			student.Courses = []primitive.ObjectID{}
+		}
+		respond(c, http.StatusOK, student.Courses, gin.H{"count": len(student.Courses)})
+	})
+
+	// HEAD /students/:id reports whether the student exists without sending it
+	byID.HEAD("", func(c *gin.Context) {
+		id := studentID(c)
+
+		ctx, cancel := dbContext(c, 5*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		n, err := studentsColl(c).CountDocuments(ctx, live(bson.M{"_id": id}), options.Count().SetLimit(1))
+		recordDBTime(c, "countDocuments", bson.M{"_id": id}, start)
+		if err != nil {
+			c.Status(dbErrorStatus(c, err))
+			return
+		}
+		if n == 0 {
+			c.Status(http.StatusNotFound)
+			return
+		}
+
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Header("X-Total-Count", "1")
+		c.Status(http.StatusOK)
+	})
+
+	// POST /students/import-json streams newline-delimited JSON (?fastWrite=true for w:1)
+	r.POST("/students/import-json", importNDJSONHandler(collection))
+
+	// PUT /students/order saves the given id order as each student's position
+	r.PUT("/students/order", func(c *gin.Context) {
+		var req struct {
+			IDs []string `json:"ids" binding:"required,min=1"`
+		}
+		if err := bindJSON(c, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if int64(len(req.IDs)) > cfg.MaxBatchSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d ids per request", cfg.MaxBatchSize)})
+			return
+		}
+
+		now := time.Now().UTC()
+		models := make([]mongo.WriteModel, 0, len(req.IDs))
+		for i, hex := range req.IDs {
+			id, err := primitive.ObjectIDFromHex(hex)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID: " + hex})
+				return
+			}
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(live(bson.M{"_id": id})).
+				SetUpdate(bson.M{"$set": bson.M{"position": i + 1, "updated_at": now}}))
+		}
+
+		ctx, cancel := dbContext(c, 10*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		var result *mongo.BulkWriteResult
+		err := retryWrite(ctx, c, "bulkWrite", func() error {
+			var err error
+			result, err = studentsColl(c).BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+			return err
+		})
+		recordDBTime(c, "bulkWrite", "reorder", start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to save order"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"matched": result.MatchedCount, "modified": result.ModifiedCount})
+	})
+
+	// PATCH /students/bulk-age sets specific ages for specific ids
+	r.PATCH("/students/bulk-age", bulkAgeHandler(collection))
+
+	// POST /students/:id/toggle-active flips the active flag atomically.
+	// Students stored before the flag existed count as active.
+	byID.POST("/toggle-active", func(c *gin.Context) {
+		id := studentID(c)
+
+		ctx, cancel := dbContext(c, 5*time.Second)
+		defer cancel()
+
+		update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"active":     bson.M{"$not": bson.A{bson.M{"$ifNull": bson.A{"$active", true}}}},
+			"updated_at": time.Now().UTC(),
+		}}}}
+		opts := options.FindOneAndUpdate().
+			SetReturnDocument(options.After).
+			SetProjection(bson.M{"active": 1})
+
+		start := time.Now()
+		var doc struct {
+			Active bool `bson:"active"`
+		}
+		err := studentsColl(c).FindOneAndUpdate(ctx, live(bson.M{"_id": id}), update, opts).Decode(&doc)
+		recordDBTime(c, "findOneAndUpdate", bson.M{"_id": id}, start)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+			return
+		}
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to update document"})
+			return
+		}
+
+		recordAudit(c, "update", id, bson.M{"active": doc.Active})
+
+		c.JSON(http.StatusOK, gin.H{"id": id, "active": doc.Active})
+	})
+
+	// POST /students/:id/tags/:tag and DELETE /students/:id/tags/:tag
+	byID.POST("/tags/:tag", tagHandler(collection, "$addToSet"))
+	byID.DELETE("/tags/:tag", tagHandler(collection, "$pull"))
+
+	// DELETE /students?filter={...} (admin) soft-deletes every match: each
+	// gets deleted_at and is purged after SOFT_DELETE_RETENTION. ?dryRun=true
+	// only counts them; otherwise ?confirm=true is required. An empty filter
+	// additionally needs ?deleteAll=true. With HONOR_LOCKS, matches someone
+	// else has locked are left alone and counted in "locked".
+	r.DELETE("/students", authRequired(), func(c *gin.Context) {
+		filter := bson.M{}
+		if raw := c.Query("filter"); raw != "" {
+			var err error
+			if filter, err = parseFilterParam(c, raw); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if len(filter) == 0 && c.Query("deleteAll") != "true" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A filter is required (or pass deleteAll=true to delete every student)"})
+			return
+		}
+
+		dryRun := c.Query("dryRun") == "true"
+		if !dryRun && c.Query("confirm") != "true" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Pass dryRun=true to preview or confirm=true to delete"})
+			return
+		}
+
+		ctx, cancel := dbContext(c, 30*time.Second)
+		defer cancel()
+
+		locked, err := findLocked(ctx, c, studentsColl(c), filter)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to check locks"})
+			return
+		}
+
+		start := time.Now()
+		if dryRun {
+			n, err := studentsColl(c).CountDocuments(ctx, writable(c, filter))
+			recordDBTime(c, "countDocuments", filter, start)
+			if err != nil {
+				dbError(c, err, gin.H{"error": "Failed to count documents"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"dryRun": true, "wouldDelete": n, "locked": len(locked), "filter": filter})
+			return
+		}
+
+		now := time.Now().UTC()
+		result, err := studentsColl(c).UpdateMany(ctx, writable(c, filter), bson.M{"$set": bson.M{softDeletedKey: now, "updated_at": now}})
+		recordDBTime(c, "updateMany", filter, start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to delete documents"})
+			return
+		}
+
+		recordAudit(c, "deleteMany", nil, bson.M{"filter": filter, "deleted": result.ModifiedCount})
+
+		c.JSON(http.StatusOK, gin.H{"deleted": result.ModifiedCount, "locked": len(locked), "filter": filter})
+	})
+
+	// PATCH /students/batch applies one update to every student in "ids".
+	// With HONOR_LOCKS, students someone else has locked are skipped and
+	// listed in "lockedIds".
+	r.PATCH("/students/batch", func(c *gin.Context) {
+		var req struct {
+			IDs    []string      `json:"ids"    binding:"required,min=1"`
+			Update StudentUpdate `json:"update"`
+		}
+		if err := bindJSON(c, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if int64(len(req.IDs)) > cfg.MaxBatchSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d ids per request", cfg.MaxBatchSize)})
+			return
+		}
+
+		set := req.Update.setFields()
+		if len(set) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+			return
+		}
+		if problems := checkUpdateFields(req.Update); len(problems) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"valid": false, "errors": problems})
+			return
+		}
+		now := time.Now().UTC()
+
+		oids := make([]primitive.ObjectID, 0, len(req.IDs))
+		invalid := []string{}
+		for _, hex := range req.IDs {
+			id, err := primitive.ObjectIDFromHex(hex)
+			if err != nil {
+				invalid = append(invalid, hex)
+				continue
+			}
+			oids = append(oids, id)
+		}
+		if len(oids) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No valid ids", "invalidIds": invalid})
+			return
+		}
+
+		ctx, cancel := dbContext(c, 10*time.Second)
+		defer cancel()
+
+		filter := bson.M{"_id": bson.M{"$in": oids}}
+		locked, err := findLocked(ctx, c, studentsColl(c), filter)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to check locks"})
+			return
+		}
+
+		start := time.Now()
+		result, err := studentsColl(c).UpdateMany(ctx, writable(c, filter), patchPipeline(set, nil, now))
+		recordDBTime(c, "updateMany", filter, start)
+		if msg := duplicateMessage(err); msg != "" {
+			c.JSON(http.StatusConflict, gin.H{"error": msg})
+			return
+		}
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to update documents"})
+			return
+		}
+
+		lockedIDs := []string{}
+		for _, id := range oids {
+			if _, ok := locked[idString(id)]; ok {
+				lockedIDs = append(lockedIDs, idString(id))
+				continue
+			}
+			recordAudit(c, "update", id, set)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"matched":    result.MatchedCount,
+			"modified":   result.ModifiedCount,
+			"invalidIds": invalid,
+			"lockedIds":  lockedIDs,
+		})
+	})
+
+	// PATCH /students/:id (?returnPrevious=true to also get the pre-update
+	// document, ?returnChanges=true for the {from, to} of each changed field,
+	// ?unset=email to remove optional fields)
+	byID.PATCH("", func(c *gin.Context) {
+		id := studentID(c)
+
+		var update StudentUpdate
+		if err := bindJSON(c, &update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		set := update.setFields()
+		unset, err := parseUnset(c.Query("unset"), set)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(set) == 0 && len(unset) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+			return
+		}
+		if problems := checkUpdateFields(update); len(problems) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"valid": false, "errors": problems})
+			return
+		}
+		now := time.Now().UTC()
+
+		// The changes are worked out from the previous version, so either
+		// option needs the document as it was before the update.
+		returnPrevious := c.Query("returnPrevious") == "true"
+		returnChanges := c.Query("returnChanges") == "true"
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		if returnPrevious || returnChanges {
+			opts.SetReturnDocument(options.Before)
+		}
+
+		ctx, cancel := dbContext(c, 5*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		var doc bson.M
+		err = retryWrite(ctx, c, "findOneAndUpdate", func() error {
+			return studentsColl(c).FindOneAndUpdate(ctx, live(bson.M{"_id": id}), patchPipeline(set, unset, now), opts).Decode(&doc)
+		})
+		recordDBTime(c, "findOneAndUpdate", bson.M{"_id": id}, start)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+			return
+		}
+		if msg := duplicateMessage(err); msg != "" {
+			c.JSON(http.StatusConflict, gin.H{"error": msg})
+			return
+		}
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to update document"})
+			return
+		}
+
+		changes := bson.M{}
+		for k, v := range set {
+			changes[k] = v
+		}
+		for _, f := range unset {
+			changes[f] = nil
+		}
+		recordAudit(c, "update", id, changes)
+
+		if !returnPrevious && !returnChanges {
+			maskFields(c, doc)
+			respond(c, http.StatusOK, doc, nil)
+			return
+		}
+
+		// Rebuild the new document from the previous one so the client gets
+		// both versions without a second read.
+		current := bson.M{}
+		for k, v := range doc {
+			current[k] = v
+		}
+		for k, v := range set {
+			current[k] = v
+		}
+		for _, f := range unset {
+			delete(current, f)
+		}
+		current["updated_at"] = now
+
+		body := gin.H{"current": current}
+		if returnPrevious {
+			body["previous"] = doc
+		}
+		if returnChanges {
+			diff := fieldChanges(doc, set, unset)
+			maskFields(c, diff)
+			body["changes"] = diff
+		}
+		maskFields(c, doc, current)
+		respond(c, http.StatusOK, body, nil)
+	})
+
+	// POST /students/:id/lock (admin, ?ttl=) and DELETE to release it
+	byID.POST("/lock", authRequired(), lockHandler(collection))
+	byID.DELETE("/lock", authRequired(), unlockHandler(collection))
+
+	// POST /students/:id/number gives a student without a student number the next one
+	byID.POST("/number", studentNumberHandler(collection))
+
+	// POST /students/:id/archive (admin) moves a student into the alumni collection
+	byID.POST("/archive", authRequired(), func(c *gin.Context) {
+		id := studentID(c)
+
+		ctx, cancel := dbContext(c, 10*time.Second)
+		defer cancel()
+
+		session, err := studentsColl(c).Database().Client().StartSession()
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to start session"})
+			return
+		}
+		defer session.EndSession(ctx)
+
+		// Read, copy and delete in one transaction so a failure at any step
+		// leaves the student where it was. The _id is preserved.
+		start := time.Now()
+		archived, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+			var student bson.M
+			if err := studentsColl(c).FindOne(sc, live(bson.M{"_id": id})).Decode(&student); err != nil {
+				return nil, err
+			}
+			now := time.Now().UTC()
+			student["archived_at"] = now
+
+			if _, err := tenantColl(c, alumniCollection).InsertOne(sc, student); err != nil {
+				return nil, err
+			}
+			if _, err := studentsColl(c).DeleteOne(sc, bson.M{"_id": id}); err != nil {
+				return nil, err
+			}
+			if err := buryStudents(sc, studentsColl(c), []interface{}{id}, now); err != nil {
+				return nil, err
+			}
+			return student, nil
+		})
+		recordDBTime(c, "archive", bson.M{"_id": id}, start)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+			return
+		}
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to archive student"})
+			return
+		}
+
+		recordAudit(c, "archive", id, nil)
+
+		student := archived.(bson.M)
+		maskFields(c, student)
+		respond(c, http.StatusOK, student, nil)
+	})
+
+	// POST /students/:id/merge/:otherId (admin) folds otherId into id in one
+	// transaction and deletes it; 404 unless both exist
+	byID.POST("/merge/:otherId", authRequired(), func(c *gin.Context) {
+		id := studentID(c)
+		otherID, err := parseStudentID(c.Param("otherId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID: " + c.Param("otherId")})
+			return
+		}
+		if otherID == id {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot merge a student into itself"})
+			return
+		}
+
+		ctx, cancel := dbContext(c, 15*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		merged, _, err := mergeStudents(ctx, studentsColl(c), id, []interface{}{otherID}, true, callerEditor(c))
+		recordDBTime(c, "merge", bson.M{"_id": id}, start)
+		if errors.Is(err, errStudentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+			return
+		}
+		var locked errLocked
+		if errors.As(err, &locked) {
+			lockConflict(c, locked.lock)
+			return
+		}
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to merge students"})
+			return
+		}
+
+		recordAudit(c, "merge", id, bson.M{"merged": []interface{}{otherID}})
+
+		respondItem(c, http.StatusOK, merged)
+	})
+
+	// Admin routes (require ADMIN_API_KEY)
+	admin := r.Group("/admin", authRequired())
+
+	// GET /admin/indexes
+	admin.GET("/indexes", func(c *gin.Context) {
+		ctx, cancel := dbContext(c, 5*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		cursor, err := studentsColl(c).Indexes().List(ctx)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to list indexes"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		var indexes []bson.M
+		err = cursor.All(ctx, &indexes)
+		recordDBTime(c, "listIndexes", "", start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to decode indexes"})
+			return
+		}
+
+		c.JSON(http.StatusOK, indexes)
+	})
+
+	// GET /admin/dbinfo
+	admin.GET("/dbinfo", func(c *gin.Context) {
+		ctx, cancel := dbContext(c, 5*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		var info bson.M
+		err := liveConn.Load().db.RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&info)
+		recordDBTime(c, "runCommand", "buildInfo", start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch build info"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"version":           info["version"],
+			"gitVersion":        info["gitVersion"],
+			"versionArray":      info["versionArray"],
+			"modules":           info["modules"],
+			"bits":              info["bits"],
+			"maxBsonObjectSize": info["maxBsonObjectSize"],
+			"storageEngines":    info["storageEngines"],
+		})
+	})
+
+	// POST /admin/reconnect (swap in a fresh MongoDB client)
+	admin.POST("/reconnect", reconnectHandler)
+
+	// GET /admin/validate-data reports stored students breaking the current schema
+	admin.GET("/validate-data", validateDataHandler(collection))
+
+	// POST /admin/repair backfills missing timestamps (?dryRun=true to only count)
+	admin.POST("/repair", repairHandler(collection))
+
+	// GET /admin/dump (extended JSON backup of the students collection)
+	admin.GET("/dump", dumpHandler(collection))
+
+	// POST /admin/restore (re-import a dump)
+	admin.POST("/restore", restoreHandler(collection))
+
+	// GET /health
+	r.GET("/health", healthHandler)
+
+	// GET /version (build metadata injected via -ldflags)
+	r.GET("/version", versionHandler)
+
+	// GET /metrics (Prometheus text format)
+	r.GET("/metrics", metricsHandler)
+
+	// GET /stats/errors (4xx/5xx counts per route)
+	r.GET("/stats/errors", errorStatsHandler)
+
+	// Background work stops when we get SIGINT/SIGTERM
+	shutdownCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go monitorDB(shutdownCtx, cfg.HealthInterval)
+	go purgeSoftDeleted(shutdownCtx, collection.Name(), cfg.PurgeInterval, cfg.DeletedRetention)
+	for _, tenant := range cfg.Tenants {
+		go purgeSoftDeleted(shutdownCtx, "students_"+strings.ToLower(tenant), cfg.PurgeInterval, cfg.DeletedRetention)
+	}
+
+	gate.ready(configureRouting(r))
+	log.Println("Ready to serve requests")
+
+	<-shutdownCtx.Done()
+	log.Println("Shutting down...")
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Println("Server shutdown error:", err)
+	}
+	if err := liveConn.Load().client.Disconnect(ctx); err != nil {
+		log.Println("MongoDB disconnect error:", err)
 	}
-	r.Run(":" + port)
 }
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// restrictedFields are stripped from responses per role. Roles missing from
+// the map see everything.
+var restrictedFields = map[string][]string{
+	"anonymous": {"email", "contact"},
+}
+
+// canSee reports whether the caller's role may see field.
+func canSee(c *gin.Context, field string) bool {
+	return !slices.Contains(restrictedFields[callerRole(c)], field)
+}
+
+// maskFields removes the fields the caller's role may not see, plus the
+// per-field change timestamps unless ?includeFieldTimestamps=true. It edits
+// the documents in place.
+func maskFields(c *gin.Context, docs ...bson.M) {
+	fields := restrictedFields[callerRole(c)]
+	if c.Query("includeFieldTimestamps") != "true" {
+		fields = append(fields[:len(fields):len(fields)], fieldTimestampsKey)
+	}
+	for _, doc := range docs {
+		for _, f := range fields {
+			delete(doc, f)
+		}
+	}
+}
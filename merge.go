@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errStudentNotFound = errors.New("student not found")
+
+// Fields combined when merging students. Array fields are unioned; scalar
+// fields are copied from a merged student only where the primary has none.
+var (
+	mergeArrayFields  = []string{"courses", "tags"}
+	mergeScalarFields = []string{"name", "age", "email"}
+)
+
+// mergeStudents folds otherIDs into primaryID in coll and deletes them,
+// leaving tombstones for the changes feed, all in one transaction. It returns the merged document and the ids that were
+// actually found and removed. With requireAll, any of otherIDs being missing
+// is errStudentNotFound and nothing is changed. With HONOR_LOCKS, any of
+// the students being locked by someone other than owner is errLocked and
+// nothing is changed either.
+func mergeStudents(ctx context.Context, coll *mongo.Collection, primaryID interface{}, otherIDs []interface{}, requireAll bool, owner string) (bson.M, []interface{}, error) {
+	session, err := coll.Database().Client().StartSession()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer session.EndSession(ctx)
+
+	var merged bson.M
+	var mergedIDs []interface{}
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		merged, mergedIDs = nil, []interface{}{}
+
+		var primary bson.M
+		err := coll.FindOne(sc, live(bson.M{"_id": primaryID})).Decode(&primary)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errStudentNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		cursor, err := coll.Find(sc, live(bson.M{"_id": bson.M{"$in": otherIDs, "$ne": primaryID}}))
+		if err != nil {
+			return nil, err
+		}
+		var others []bson.M
+		if err := cursor.All(sc, &others); err != nil {
+			return nil, err
+		}
+		if requireAll && len(others) < len(otherIDs) {
+			return nil, errStudentNotFound
+		}
+		if cfg.HonorLocks {
+			now := time.Now()
+			for _, doc := range append([]bson.M{primary}, others...) {
+				if l := docLock(doc); l.heldByOther(owner, now) {
+					return nil, errLocked{l}
+				}
+			}
+		}
+
+		// The merged students go first: the primary may take over a unique
+		// field such as email from one of them.
+		now := time.Now().UTC()
+		for _, o := range others {
+			mergedIDs = append(mergedIDs, o["_id"])
+		}
+		if len(mergedIDs) > 0 {
+			if _, err := coll.DeleteMany(sc, bson.M{"_id": bson.M{"$in": mergedIDs}}); err != nil {
+				return nil, err
+			}
+			if err := buryStudents(sc, coll, mergedIDs, now); err != nil {
+				return nil, err
+			}
+		}
+
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		if err := coll.FindOneAndUpdate(sc, live(bson.M{"_id": primaryID}), mergeUpdate(primary, others, now), opts).Decode(&merged); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, mergedIDs, nil
+}
+
+// mergeUpdate builds the update that folds others into primary: scalar
+// fields the primary lacks are taken from the first of others that has
+// them, and array fields get the union of all values.
+func mergeUpdate(primary bson.M, others []bson.M, now time.Time) bson.M {
+	set := bson.M{"updated_at": now}
+	for _, f := range mergeScalarFields {
+		if !isEmptyValue(primary[f]) {
+			continue
+		}
+		for _, o := range others {
+			if !isEmptyValue(o[f]) {
+				set[f] = o[f]
+				break
+			}
+		}
+	}
+
+	addToSet := bson.M{}
+	for _, f := range mergeArrayFields {
+		var values bson.A
+		for _, o := range others {
+			if arr, ok := o[f].(bson.A); ok {
+				values = append(values, arr...)
+			}
+		}
+		if len(values) > 0 {
+			addToSet[f] = bson.M{"$each": values}
+		}
+	}
+
+	update := bson.M{"$set": set}
+	if len(addToSet) > 0 {
+		update["$addToSet"] = addToSet
+	}
+	return update
+}
+
+// isEmptyValue reports whether a decoded scalar field counts as "not set":
+// missing, null or the empty string. Zero is a real value, so a primary
+// aged 0 keeps its age.
+func isEmptyValue(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	}
+	return false
+}
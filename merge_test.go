@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestMergeUpdate(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	primary := bson.M{"name": "Ann", "age": int32(0), "tags": bson.A{"a"}}
+	others := []bson.M{
+		{"name": "Annie", "age": int32(30), "tags": bson.A{"b"}},
+		{"name": "A.", "email": "ann@example.com", "tags": bson.A{"a", "c"}},
+	}
+
+	update := mergeUpdate(primary, others, now)
+
+	set := update["$set"].(bson.M)
+	if got := set["email"]; got != "ann@example.com" {
+		t.Errorf("$set.email = %v, want ann@example.com", got)
+	}
+	if got, ok := set["age"]; ok {
+		t.Errorf("$set.age = %v, want the primary's age 0 kept", got)
+	}
+	if got, ok := set["name"]; ok {
+		t.Errorf("$set.name = %v, want the primary's name kept", got)
+	}
+	if got := set["updated_at"]; got != now {
+		t.Errorf("$set.updated_at = %v, want %v", got, now)
+	}
+
+	tags := update["$addToSet"].(bson.M)["tags"].(bson.M)["$each"].(bson.A)
+	if len(tags) != 3 {
+		t.Errorf("$addToSet.tags.$each = %v, want b, a and c", tags)
+	}
+}
+
+func TestIsEmptyValue(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want bool
+	}{
+		{in: nil, want: true},
+		{in: "", want: true},
+		{in: "Ann", want: false},
+		{in: int32(0), want: false},
+		{in: int64(0), want: false},
+		{in: 0.0, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isEmptyValue(tt.in); got != tt.want {
+			t.Errorf("isEmptyValue(%#v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestMergeStudentsTakesEmail needs a MongoDB replica set (for transactions)
+// in MONGODB_URI or the MONGO_* variables, and is skipped without one.
+func TestMergeStudentsTakesEmail(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	conn, err := connectMongo(ctx, "")
+	if err != nil {
+		t.Skipf("no MongoDB: %v", err)
+	}
+	defer conn.client.Disconnect(context.Background())
+
+	coll := conn.db.Collection(fmt.Sprintf("merge_test_%s", primitive.NewObjectID().Hex()))
+	defer coll.Drop(context.Background())
+	defer conn.db.Collection(tombstonesCollection).DeleteMany(context.Background(), bson.M{"collection": coll.Name()})
+	if err := ensureEmailIndex(ctx, coll); err != nil {
+		t.Fatalf("ensureEmailIndex error = %v", err)
+	}
+
+	primary, err := coll.InsertOne(ctx, bson.M{"name": "Ann"})
+	if err != nil {
+		t.Fatalf("InsertOne error = %v", err)
+	}
+	other, err := coll.InsertOne(ctx, bson.M{"name": "Annie", "email": "ann@example.com"})
+	if err != nil {
+		t.Fatalf("InsertOne error = %v", err)
+	}
+
+	merged, mergedIDs, err := mergeStudents(ctx, coll, primary.InsertedID, []interface{}{other.InsertedID}, true, "admin")
+	if err != nil {
+		t.Fatalf("mergeStudents error = %v", err)
+	}
+	if got := merged["email"]; got != "ann@example.com" {
+		t.Errorf("merged email = %v, want ann@example.com", got)
+	}
+	if len(mergedIDs) != 1 || mergedIDs[0] != other.InsertedID {
+		t.Errorf("mergedIDs = %v, want [%v]", mergedIDs, other.InsertedID)
+	}
+	err = coll.FindOne(ctx, bson.M{"_id": other.InsertedID}).Err()
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("FindOne(merged student) error = %v, want %v", err, mongo.ErrNoDocuments)
+	}
+}
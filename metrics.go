@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dbDurationBuckets are the upper bounds, in seconds, of the DB duration
+// histogram buckets.
+var dbDurationBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram is a Prometheus-style cumulative histogram per label value.
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+var dbDurations = &histogram{buckets: dbDurationBuckets, series: map[string]*histogramSeries{}}
+
+func (h *histogram) observe(label string, d time.Duration) {
+	secs := d.Seconds()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[label]
+	if s == nil {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[label] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, secs); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += secs
+	s.count++
+}
+
+// write renders h in the Prometheus text format as metric name, with the
+// series keyed by labelName.
+func (h *histogram) write(b *strings.Builder, name, help, labelName string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	labels := make([]string, 0, len(h.series))
+	for l := range h.series {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	for _, l := range labels {
+		s := h.series[l]
+		var cum uint64
+		for i, le := range h.buckets {
+			cum += s.counts[i]
+			fmt.Fprintf(b, "%s_bucket{%s=%q,le=%q} %d\n", name, labelName, l, strconv.FormatFloat(le, 'g', -1, 64), cum)
+		}
+		fmt.Fprintf(b, "%s_bucket{%s=%q,le=\"+Inf\"} %d\n", name, labelName, l, s.count)
+		fmt.Fprintf(b, "%s_sum{%s=%q} %g\n", name, labelName, l, s.sum)
+		fmt.Fprintf(b, "%s_count{%s=%q} %d\n", name, labelName, l, s.count)
+	}
+}
+
+// dbOperationType buckets a driver call name as passed to recordDBTime
+// ("findOne", "insertMany", "findOneAndUpdate", ...) into the operation
+// label of the DB duration histogram. Multi-step operations such as
+// transactions count as "other".
+func dbOperationType(op string) string {
+	switch {
+	case strings.HasPrefix(op, "insert"):
+		return "insert"
+	case strings.Contains(op, "pdate") || strings.HasPrefix(op, "replace"):
+		return "update"
+	case strings.Contains(op, "elete"):
+		return "delete"
+	case strings.HasPrefix(op, "find"), strings.HasPrefix(op, "count"), strings.HasPrefix(op, "distinct"):
+		return "find"
+	case op == "aggregate":
+		return "aggregate"
+	case op == "bulkWrite":
+		return "bulkWrite"
+	}
+	return "other"
+}
+
+// metricsHandler serves GET /metrics in the Prometheus text exposition
+// format.
+func metricsHandler(c *gin.Context) {
+	var b strings.Builder
+	dbDurations.write(&b, "mongo_operation_duration_seconds", "Time spent in MongoDB calls, by operation type.", "operation")
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
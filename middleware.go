@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireDB short-circuits with 503 while the Mongo collection is not
+// initialized, so handlers never dereference a nil collection. It also acts
+// as a circuit breaker: while the background ping reports the database as
+// down, requests fail fast instead of waiting out their timeouts. /health
+// is always let through so it can report the state, and /version and
+// /metrics because they never touch the database.
+func requireDB() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if path := c.FullPath(); path == "/health" || path == "/version" || path == "/metrics" {
+			c.Next()
+			return
+		}
+		if liveConn.Load() == nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+			return
+		}
+		if !dbHealthy.Load() {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "database unavailable"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// concurrencyExempt routes bypass the in-flight limit: monitoring must keep
+// working during overload, and SSE streams would hold a slot for their
+// whole lifetime.
+var concurrencyExempt = map[string]bool{
+	"/health":          true,
+	"/stats/errors":    true,
+	"/metrics":         true,
+	"/students/stream": true,
+}
+
+// limitConcurrency caps in-flight requests at max using a buffered channel
+// as a semaphore. A request waits up to wait for a free slot before getting
+// 503.
+func limitConcurrency(max int64, wait time.Duration) gin.HandlerFunc {
+	slots := make(chan struct{}, max)
+
+	return func(c *gin.Context) {
+		if concurrencyExempt[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case slots <- struct{}{}:
+		case <-timer.C:
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Server is busy, try again shortly"})
+			return
+		}
+		defer func() { <-slots }()
+
+		c.Next()
+	}
+}
+
+// studentIDKey is the context key holding the parsed :id of the request.
+const studentIDKey = "studentID"
+
+// parseIDParam parses the :id path param once for every route in the
+// /students/:id group and aborts with 400 when it is not a valid id.
+// Handlers read the result with studentID.
+func parseIDParam() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := parseStudentID(c.Param("id"))
+		if err != nil {
+			if c.Request.Method == http.MethodHead {
+				c.AbortWithStatus(http.StatusBadRequest)
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid student ID"})
+			return
+		}
+		c.Set(studentIDKey, id)
+		c.Next()
+	}
+}
+
+// studentID returns the _id value stored by parseIDParam.
+func studentID(c *gin.Context) interface{} {
+	return c.MustGet(studentIDKey)
+}
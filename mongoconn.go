@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// mongoConn is a MongoDB client together with the handles built from it.
+type mongoConn struct {
+	client   *mongo.Client
+	db       *mongo.Database
+	students *mongo.Collection
+	alumni   *mongo.Collection
+	audit    *mongo.Collection
+	collOpts *options.CollectionOptions // write concern etc. for student collections
+}
+
+// liveConn is the connection requests use. POST /admin/reconnect replaces
+// it while requests are in flight, so code that outlives a single request
+// must load it again rather than keep the handles.
+var liveConn atomic.Pointer[mongoConn]
+
+var errNoMongoURI = errors.New("you must set MONGODB_URI, or MONGO_HOST, MONGO_USER, MONGO_PASSWORD and MONGO_DB")
+
+// connectMongo connects with the MongoDB settings currently in the
+// environment (URI, TLS files) and writeConcern, and pings the primary. A
+// client that fails the ping is disconnected again.
+func connectMongo(ctx context.Context, writeConcern string) (*mongoConn, error) {
+	uri := mongoURI()
+	if uri == "" {
+		return nil, errNoMongoURI
+	}
+	wc, err := parseWriteConcern(writeConcern)
+	if err != nil {
+		return nil, fmt.Errorf("WRITE_CONCERN: %w", err)
+	}
+
+	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
+	clientOptions := options.Client().ApplyURI(uri).SetServerAPIOptions(serverAPI)
+	tlsConfig, err := mongoTLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("TLS: %w", err)
+	}
+	if tlsConfig != nil {
+		clientOptions.SetTLSConfig(tlsConfig)
+	}
+
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, fmt.Errorf("connection error: %w", err)
+	}
+	if err := client.Ping(ctx, readpref.Primary()); err != nil {
+		client.Disconnect(context.Background())
+		return nil, fmt.Errorf("ping failed: %w", err)
+	}
+
+	collOpts := options.Collection()
+	if wc != nil {
+		collOpts.SetWriteConcern(wc)
+	}
+	db := client.Database("students")
+	return &mongoConn{
+		client:   client,
+		db:       db,
+		students: db.Collection("theirdata", collOpts),
+		alumni:   db.Collection("alumni"),
+		audit:    db.Collection("audit"),
+		collOpts: collOpts,
+	}, nil
+}
+
+// auditColl is the audit collection of the live connection, or nil before
+// one is established.
+func auditColl() *mongo.Collection {
+	if conn := liveConn.Load(); conn != nil {
+		return conn.audit
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// mongoTLSConfig builds the TLS settings for the MongoDB connection from
+// MONGO_TLS_CA_FILE (PEM bundle of extra trusted CAs, for private
+// authorities) and MONGO_TLS_CERT_FILE / MONGO_TLS_KEY_FILE (a client
+// certificate, for x.509 auth). It returns nil when none are set, leaving
+// TLS to the URI.
+func mongoTLSConfig() (*tls.Config, error) {
+	caFile := os.Getenv("MONGO_TLS_CA_FILE")
+	certFile := os.Getenv("MONGO_TLS_CERT_FILE")
+	keyFile := os.Getenv("MONGO_TLS_KEY_FILE")
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+
+	conf := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		conf.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("MONGO_TLS_CERT_FILE and MONGO_TLS_KEY_FILE must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return conf, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/url"
+	"os"
+)
+
+// mongoURI returns MONGODB_URI, or builds one from MONGO_HOST, MONGO_USER,
+// MONGO_PASSWORD and MONGO_DB when the platform provides them separately.
+// Credentials are URL-encoded. MONGO_SCHEME may be set to "mongodb+srv"
+// for SRV hosts such as Atlas; it defaults to "mongodb". An empty string
+// means neither form is configured.
+func mongoURI() string {
+	if uri := os.Getenv("MONGODB_URI"); uri != "" {
+		return uri
+	}
+
+	host := os.Getenv("MONGO_HOST")
+	user := os.Getenv("MONGO_USER")
+	password := os.Getenv("MONGO_PASSWORD")
+	dbName := os.Getenv("MONGO_DB")
+	if host == "" || user == "" || password == "" || dbName == "" {
+		return ""
+	}
+
+	scheme := os.Getenv("MONGO_SCHEME")
+	if scheme == "" {
+		scheme = "mongodb"
+	}
+
+	u := url.URL{
+		Scheme: scheme,
+		User:   url.UserPassword(user, password),
+		Host:   host,
+		Path:   "/" + dbName,
+	}
+	return u.String()
+}
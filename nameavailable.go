@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// nameCacheTTL is how long an availability answer is reused. Checks fire
+// on every keystroke, so a short TTL absorbs most of them; the unique name
+// index still has the final say when the student is created.
+const (
+	nameCacheTTL     = 5 * time.Second
+	nameCacheMaxSize = 10000
+)
+
+// nameCache remembers recent availability answers keyed by collection and
+// lower-cased name, matching the case-insensitive name collation.
+type nameCache struct {
+	mu      sync.Mutex
+	entries map[string]nameCacheEntry
+}
+
+type nameCacheEntry struct {
+	available bool
+	expires   time.Time
+}
+
+func (nc *nameCache) get(key string, now time.Time) (available, ok bool) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	e, ok := nc.entries[key]
+	if !ok || now.After(e.expires) {
+		return false, false
+	}
+	return e.available, true
+}
+
+func (nc *nameCache) put(key string, available bool, now time.Time) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	if len(nc.entries) >= nameCacheMaxSize {
+		nc.entries = map[string]nameCacheEntry{}
+	}
+	nc.entries[key] = nameCacheEntry{available: available, expires: now.Add(nameCacheTTL)}
+}
+
+// nameAvailableHandler serves GET /students/name-available?name=, answering
+// whether no student has that name under nameCollation.
+func nameAvailableHandler(coll *mongo.Collection) gin.HandlerFunc {
+	cache := &nameCache{entries: map[string]nameCacheEntry{}}
+
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		name := strings.TrimSpace(c.Query("name"))
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+			return
+		}
+
+		key := coll.Name() + "\x00" + strings.ToLower(name)
+		now := time.Now()
+		c.Header("Cache-Control", "private, max-age=5")
+		if available, ok := cache.get(key, now); ok {
+			c.JSON(http.StatusOK, gin.H{"name": name, "available": available})
+			return
+		}
+
+		ctx, cancel := dbContext(c, 5*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		opts := options.Count().SetLimit(1).SetCollation(nameCollation)
+		n, err := coll.CountDocuments(ctx, bson.M{"name": name}, opts)
+		recordDBTime(c, "countDocuments", bson.M{"name": name}, start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to count documents"})
+			return
+		}
+
+		available := n == 0
+		cache.put(key, available, now)
+		c.JSON(http.StatusOK, gin.H{"name": name, "available": available})
+	}
+}
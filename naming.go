@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Values of JSON_NAMING.
+const (
+	namingSnake = "snake"
+	namingCamel = "camel"
+)
+
+// camelKeys renames the snake_case keys of the documents in data to
+// camelCase, in place, so created_at is sent as createdAt. Storage keeps
+// the snake_case names; only the JSON wire format changes. Keys starting
+// with an underscore, such as _id, are kept as they are.
+func camelKeys(data interface{}) {
+	eachDoc(data, func(doc map[string]interface{}) {
+		var renamed []string
+		for key := range doc {
+			if camelName(key) != key {
+				renamed = append(renamed, key)
+			}
+		}
+		for _, key := range renamed {
+			doc[camelName(key)] = doc[key]
+			delete(doc, key)
+		}
+	})
+}
+
+// camelName is field as camelCase: "created_at" becomes "createdAt".
+func camelName(field string) string {
+	if strings.HasPrefix(field, "_") || !strings.Contains(field, "_") {
+		return field
+	}
+	parts := strings.Split(field, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// storedName is the stored, snake_case name of a field named by a client
+// in either style: "createdAt" and "created_at" both become "created_at".
+// Query params that name fields, such as ?sort= and ?filter=, go through
+// it so they accept the names the client sees.
+func storedName(field string) string {
+	var b strings.Builder
+	for i, r := range field {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
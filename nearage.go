@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// nearAgeHandler serves GET /students/near-age?age=22&count=5: the count
+// students whose age is closest to age, closest first, each carrying its
+// "ageDiff" from the target. Ties are broken by _id so the answer is
+// stable. count defaults to 5.
+func nearAgeHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		if c.Query("age") == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "age is required"})
+			return
+		}
+		age, err := intParam("age", c.Query("age"), 0, maxAge)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		count := int64(5)
+		if v := c.Query("count"); v != "" {
+			if count, err = intParam("count", v, 1, cfg.MaxPageSize); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		ctx, cancel := dbContext(c, 10*time.Second)
+		defer cancel()
+
+		pipeline := mongo.Pipeline{
+			ageMatch,
+			{{Key: "$addFields", Value: bson.D{
+				{Key: "ageDiff", Value: bson.D{{Key: "$abs", Value: bson.A{
+					bson.D{{Key: "$subtract", Value: bson.A{"$age", age}}},
+				}}}},
+			}}},
+			{{Key: "$sort", Value: bson.D{{Key: "ageDiff", Value: 1}, {Key: "_id", Value: 1}}}},
+			{{Key: "$limit", Value: count}},
+		}
+
+		start := time.Now()
+		cursor, err := coll.Aggregate(ctx, pipeline)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to aggregate documents"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		results := []bson.M{}
+		err = cursor.All(ctx, &results)
+		recordDBTime(c, "aggregate", "near age", start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to decode documents"})
+			return
+		}
+
+		maskFields(c, results...)
+		respond(c, http.StatusOK, results, gin.H{"age": age, "count": len(results)})
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// formatKey holds the negotiated response media type in the gin context.
+const formatKey = "format"
+
+const (
+	mimeJSON    = "application/json"
+	mimeCSV     = "text/csv"
+	mimeXML     = "application/xml"
+	mimeCompact = "application/vnd.firstrender.compact+json"
+)
+
+// formatParams maps ?format= values to media types. The query param takes
+// precedence over Accept.
+var formatParams = map[string]string{
+	"json":    mimeJSON,
+	"csv":     mimeCSV,
+	"xml":     mimeXML,
+	"compact": mimeCompact,
+}
+
+// negotiate picks the response format among offers from ?format= or the
+// Accept header (the first offer wins for a missing Accept or */*), and
+// stores it under formatKey. Requests accepting none of the offers get 406.
+func negotiate(offers ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var format string
+		if param := c.Query("format"); param != "" {
+			if mime, ok := formatParams[param]; ok && slices.Contains(offers, mime) {
+				format = mime
+			}
+		} else {
+			format = c.NegotiateFormat(offers...)
+		}
+		if format == "" {
+			c.AbortWithStatusJSON(http.StatusNotAcceptable, gin.H{
+				"error":     "Not Acceptable",
+				"supported": offers,
+			})
+			return
+		}
+		c.Set(formatKey, format)
+		c.Next()
+	}
+}
+
+// responseFormat returns the negotiated media type, defaulting to JSON for
+// routes without negotiation. The envelope media type counts as JSON; the
+// compact format is JSON too but has its own shape, so it is kept.
+func responseFormat(c *gin.Context) string {
+	format := c.GetString(formatKey)
+	if format == "" || (format != mimeCompact && strings.HasSuffix(format, "+json")) {
+		return mimeJSON
+	}
+	return format
+}
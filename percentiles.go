@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// agePercentiles are the percentiles served by GET /students/age-percentiles.
+var agePercentiles = []struct {
+	key string
+	p   float64
+}{
+	{"p25", 0.25},
+	{"p50", 0.50},
+	{"p75", 0.75},
+	{"p90", 0.90},
+}
+
+// agePercentilesHandler serves GET /students/age-percentiles. It uses the
+// $percentile accumulator (MongoDB 7.0+) and falls back to sorting every age
+// into one array and picking by nearest rank on older servers. Both give
+// null percentiles for an empty collection.
+func agePercentilesHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		ctx, cancel := dbContext(c, 30*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		method := "percentile"
+		result, err := aggregateOne(ctx, coll, percentilePipeline())
+		if hasServerErrorCode(err, 15952, 168) { // unknown accumulator or operator
+			method = "sorted"
+			result, err = aggregateOne(ctx, coll, sortedPercentilePipeline())
+		}
+		recordDBTime(c, "aggregate", "age percentiles", start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to aggregate documents"})
+			return
+		}
+
+		out := gin.H{"count": 0, "method": method}
+		if result != nil {
+			out["count"] = result["count"]
+		}
+		for _, ap := range agePercentiles {
+			out[ap.key] = nil
+			if result != nil {
+				out[ap.key] = result[ap.key]
+			}
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// ageMatch keeps live students with a numeric age.
+var ageMatch = bson.D{{Key: "$match", Value: live(bson.M{"age": bson.M{"$type": "number"}})}}
+
+func percentilePipeline() mongo.Pipeline {
+	ps := bson.A{}
+	for _, ap := range agePercentiles {
+		ps = append(ps, ap.p)
+	}
+
+	project := bson.D{{Key: "_id", Value: 0}, {Key: "count", Value: 1}}
+	for i, ap := range agePercentiles {
+		project = append(project, bson.E{Key: ap.key, Value: bson.D{{Key: "$arrayElemAt", Value: bson.A{"$ps", i}}}})
+	}
+
+	return mongo.Pipeline{
+		ageMatch,
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "ps", Value: bson.D{{Key: "$percentile", Value: bson.D{
+				{Key: "input", Value: "$age"},
+				{Key: "p", Value: ps},
+				{Key: "method", Value: "approximate"},
+			}}}},
+		}}},
+		{{Key: "$project", Value: project}},
+	}
+}
+
+// sortedPercentilePipeline picks the ceil(p*n)-th smallest age for each p.
+func sortedPercentilePipeline() mongo.Pipeline {
+	project := bson.D{{Key: "_id", Value: 0}, {Key: "count", Value: 1}}
+	for _, ap := range agePercentiles {
+		rank := bson.D{{Key: "$subtract", Value: bson.A{
+			bson.D{{Key: "$ceil", Value: bson.D{{Key: "$multiply", Value: bson.A{ap.p, "$count"}}}}},
+			1,
+		}}}
+		project = append(project, bson.E{Key: ap.key, Value: bson.D{{Key: "$arrayElemAt", Value: bson.A{"$ages", rank}}}})
+	}
+
+	return mongo.Pipeline{
+		ageMatch,
+		{{Key: "$sort", Value: bson.D{{Key: "age", Value: 1}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "ages", Value: bson.D{{Key: "$push", Value: "$age"}}},
+		}}},
+		{{Key: "$project", Value: project}},
+	}
+}
+
+// aggregateOne runs pipeline and decodes its first result, or returns nil
+// when it produced none.
+func aggregateOne(ctx context.Context, coll *mongo.Collection, pipeline mongo.Pipeline) (bson.M, error) {
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	if !cursor.Next(ctx) {
+		return nil, cursor.Err()
+	}
+	var result bson.M
+	err = cursor.Decode(&result)
+	return result, err
+}
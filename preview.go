@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// previewSampleSize is how many matches GET /students/preview returns
+// unless ?sample= asks for a different number.
+const previewSampleSize = 5
+
+// previewHandler serves GET /students/preview?filter=&sample=: how many
+// students a ?filter= (the same JSON accepted by the bulk endpoints)
+// matches, plus the first few of them in _id order, without changing
+// anything. It is meant for checking a filter before passing it to a bulk
+// update or delete. An absent filter matches every student.
+func previewHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		filter := bson.M{}
+		if raw := c.Query("filter"); raw != "" {
+			var err error
+			if filter, err = parseFilterParam(c, raw); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		sample := int64(previewSampleSize)
+		if v := c.Query("sample"); v != "" {
+			var err error
+			if sample, err = intParam("sample", v, 1, cfg.MaxPageSize); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		ctx, cancel := dbContext(c, 10*time.Second)
+		defer cancel()
+
+		start := time.Now()
+		total, err := coll.CountDocuments(ctx, live(filter))
+		recordDBTime(c, "countDocuments", filter, start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to count documents"})
+			return
+		}
+
+		findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(sample)
+		if projection := listProjection(c); projection != nil {
+			findOptions.SetProjection(projection)
+		}
+
+		start = time.Now()
+		cursor, err := coll.Find(ctx, live(filter), findOptions)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch documents"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		results := []bson.M{}
+		err = cursor.All(ctx, &results)
+		recordDBTime(c, "find", filter, start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to decode documents"})
+			return
+		}
+
+		maskFields(c, results...)
+		renderDocs(c, results)
+		c.JSON(http.StatusOK, gin.H{"filter": filter, "count": total, "sample": results})
+	}
+}
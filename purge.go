@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// softDeletedKey marks a document as soft-deleted, holding when it was
+// deleted. Documents without it are live.
+const softDeletedKey = "deleted_at"
+
+// live returns a copy of filter that also leaves out soft-deleted students.
+// Every read and write of students goes through it, so a deleted student is
+// gone to clients until purged. GET /students/changes, dumps and the data
+// checks still see it, and it keeps its name and email reserved by the
+// unique indexes.
+func live(filter bson.M) bson.M {
+	f := bson.M{softDeletedKey: bson.M{"$exists": false}}
+	for k, v := range filter {
+		f[k] = v
+	}
+	return f
+}
+
+// liveStage is the first stage of aggregations over students, the pipeline
+// form of live.
+var liveStage = bson.D{{Key: "$match", Value: live(nil)}}
+
+// purgeSoftDeleted permanently removes, every interval until ctx is
+// cancelled, the documents of the named collection soft-deleted longer than
+// retention ago, along with its tombstones from that long ago. Each run that
+// purges anything is logged with the count.
+func purgeSoftDeleted(ctx context.Context, name string, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		coll := liveConn.Load().db.Collection(name)
+		cutoff := time.Now().UTC().Add(-retention)
+		runCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		result, err := coll.DeleteMany(runCtx, bson.M{softDeletedKey: bson.M{"$lt": cutoff}})
+		if err == nil && result.DeletedCount > 0 {
+			if terr := touchCollection(runCtx, coll); terr != nil {
+				log.Printf("Failed to record purge of %s: %v", coll.Name(), terr)
+			}
+		}
+		if err == nil {
+			_, err = coll.Database().Collection(tombstonesCollection).DeleteMany(runCtx,
+				bson.M{"collection": coll.Name(), softDeletedKey: bson.M{"$lt": cutoff}})
+		}
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		switch {
+		case err != nil:
+			log.Printf("Failed to purge soft-deleted %s: %v", coll.Name(), err)
+		case result.DeletedCount > 0:
+			log.Printf("Purged %d %s soft-deleted before %s", result.DeletedCount, coll.Name(), cutoff.Format(time.RFC3339))
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// sortableFields is the whitelist of fields clients may sort on.
+var sortableFields = map[string]bool{
+	"_id":            true,
+	"name":           true,
+	"age":            true,
+	"position":       true,
+	"student_number": true,
+}
+
+// parseSort turns a comma-separated sort spec such as "age,-name" into a
+// Mongo sort document. A leading "-" sorts that field descending.
+func parseSort(spec string) (bson.D, error) {
+	var sort bson.D
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		order := 1
+		if strings.HasPrefix(part, "-") {
+			order = -1
+			part = part[1:]
+		}
+
+		field := storedName(part)
+		if !sortableFields[field] {
+			return nil, fmt.Errorf("cannot sort by %q", part)
+		}
+		sort = append(sort, bson.E{Key: field, Value: order})
+	}
+	return sort, nil
+}
+
+// intParam parses the query param name from value, which must be an
+// integer in [min, max]. Every numeric query param goes through it so they
+// all fail the same way, with a message naming the param and its range.
+func intParam(name, value string, min, max int64) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < min || n > max {
+		if max == math.MaxInt64 {
+			return 0, fmt.Errorf("%s must be an integer of at least %d", name, min)
+		}
+		return 0, fmt.Errorf("%s must be an integer between %d and %d", name, min, max)
+	}
+	return n, nil
+}
+
+// parsePagination reads ?limit and ?skip. The limit is clamped to max and
+// defaults to it when absent.
+func parsePagination(limitParam, skipParam string, max int64) (limit, skip int64, err error) {
+	limit = max
+	if limitParam != "" {
+		if limit, err = intParam("limit", limitParam, 1, math.MaxInt64); err != nil {
+			return 0, 0, err
+		}
+		if limit > max {
+			limit = max
+		}
+	}
+
+	if skipParam != "" {
+		if skip, err = intParam("skip", skipParam, 0, math.MaxInt64); err != nil {
+			return 0, 0, err
+		}
+	}
+	return limit, skip, nil
+}
+
+// parsePage reads ?page (1-based, default 1) and ?pageSize for page-style
+// pagination. pageSize defaults to and is clamped at max.
+func parsePage(pageParam, sizeParam string, max int64) (page, size int64, err error) {
+	page, size = 1, max
+	if sizeParam != "" {
+		if size, err = intParam("pageSize", sizeParam, 1, math.MaxInt64); err != nil {
+			return 0, 0, err
+		}
+		if size > max {
+			size = max
+		}
+	}
+	if pageParam != "" {
+		// Bounded so (page-1)*size can't overflow the skip.
+		if page, err = intParam("page", pageParam, 1, math.MaxInt64/size); err != nil {
+			return 0, 0, err
+		}
+	}
+	return page, size, nil
+}
+
+// parseFilter builds a Mongo filter from the list query parameters:
+// ?name= (case-insensitive substring), ?minAge= / ?maxAge= (inclusive) and
+// ?active=true|false. Students stored before the active flag existed count
+// as active. ?tag= may repeat; a student matches if it has any of the tags,
+// or all of them with ?matchAll=true. Soft-deleted students never match.
+func parseFilter(c *gin.Context) (bson.M, error) {
+	filter := live(nil)
+
+	if name := c.Query("name"); name != "" {
+		filter["name"] = bson.M{"$regex": regexp.QuoteMeta(name), "$options": "i"}
+	}
+
+	age := bson.M{}
+	for param, op := range map[string]string{"minAge": "$gte", "maxAge": "$lte"} {
+		v := c.Query(param)
+		if v == "" {
+			continue
+		}
+		n, err := intParam(param, v, 0, maxAge)
+		if err != nil {
+			return nil, err
+		}
+		age[op] = n
+	}
+	if len(age) > 0 {
+		filter["age"] = age
+	}
+
+	if v := c.Query("active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("active must be true or false")
+		}
+		if active {
+			filter["active"] = bson.M{"$ne": false}
+		} else {
+			filter["active"] = false
+		}
+	}
+
+	if tags := c.QueryArray("tag"); len(tags) > 0 {
+		op := "$in"
+		if c.Query("matchAll") == "true" {
+			op = "$all"
+		}
+		filter["tags"] = bson.M{op: tags}
+	}
+
+	return filter, nil
+}
+
+// listProjection excludes the heavy fields in cfg.ListExcludedFields from
+// list responses unless the client asks for them with ?fields= or ?expand=
+// (comma-separated). It returns nil when nothing needs excluding.
+func listProjection(c *gin.Context) bson.M {
+	requested := map[string]bool{}
+	for _, param := range []string{"fields", "expand"} {
+		for _, f := range strings.Split(c.Query(param), ",") {
+			requested[strings.TrimSpace(f)] = true
+		}
+	}
+
+	projection := bson.M{}
+	for _, f := range cfg.ListExcludedFields {
+		if !requested[f] {
+			projection[f] = 0
+		}
+	}
+	if len(projection) == 0 {
+		return nil
+	}
+	return projection
+}
+
+// effectiveSort parses spec, falling back to DEFAULT_SORT when it is empty,
+// and appends _id as a tiebreaker so documents with equal sort keys keep a
+// stable order across pages.
+func effectiveSort(spec string) (bson.D, error) {
+	if strings.TrimSpace(spec) == "" {
+		spec = cfg.DefaultSort
+	}
+	sort, err := parseSort(spec)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range sort {
+		if e.Key == "_id" {
+			return sort, nil
+		}
+	}
+	return append(sort, bson.E{Key: "_id", Value: 1}), nil
+}
+
+// formatSort renders a sort document back into the ?sort= syntax.
+func formatSort(sort bson.D) string {
+	parts := make([]string, len(sort))
+	for i, e := range sort {
+		if e.Value == -1 {
+			parts[i] = "-" + e.Key
+		} else {
+			parts[i] = e.Key
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// searchFilter matches q case-insensitively as a substring of name, and of
+// email for callers allowed to see it.
+func searchFilter(c *gin.Context, q string) bson.M {
+	pattern := bson.M{"$regex": regexp.QuoteMeta(q), "$options": "i"}
+	clauses := bson.A{bson.M{"name": pattern}}
+	if canSee(c, "email") {
+		clauses = append(clauses, bson.M{"email": pattern})
+	}
+	return bson.M{"$or": clauses}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimiter is a per-key token bucket: each key may make up to burst
+// requests at once, refilled at rate requests per second.
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	rate      float64
+	burst     float64
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// bucketIdleTTL is how long an untouched bucket is kept. After this it would
+// be full again anyway, so dropping it changes nothing.
+const bucketIdleTTL = 10 * time.Minute
+
+func newRateLimiter(rate float64, burst int64) *rateLimiter {
+	return &rateLimiter{
+		buckets: map[string]*tokenBucket{},
+		rate:    rate,
+		burst:   float64(burst),
+	}
+}
+
+// setLimits changes the rate and burst for all keys.
+func (l *rateLimiter) setLimits(rate float64, burst int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = rate
+	l.burst = float64(burst)
+}
+
+// allow consumes a token for key, reporting false when none are left.
+func (l *rateLimiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > bucketIdleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// rateLimit throttles callers per client IP. Callers holding the admin API
+// key are exempt; the check runs before a token is taken so their requests
+// never count against the IP's budget.
+func rateLimit(l *rateLimiter) gin.HandlerFunc {
+	apiKey := os.Getenv("ADMIN_API_KEY")
+
+	return func(c *gin.Context) {
+		if hasAdminKey(c, apiKey) {
+			c.Next()
+			return
+		}
+
+		if !l.allow(c.ClientIP()) {
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// appReady is set once MongoDB is connected, pinged and indexed and the
+// router is built. The server listens before that, so the platform sees the
+// port open while startup runs.
+var appReady atomic.Bool
+
+// startupGate is the server's handler. Until ready is called it answers
+// every request itself: /health with a "starting" status and everything
+// else with 503 and Retry-After, so nothing reaches a handler whose
+// collection is not set up yet.
+type startupGate struct {
+	router atomic.Pointer[http.Handler]
+}
+
+// ready hands all further requests to h.
+func (g *startupGate) ready(h http.Handler) {
+	g.router.Store(&h)
+	appReady.Store(true)
+}
+
+func (g *startupGate) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if appReady.Load() {
+		(*g.router.Load()).ServeHTTP(w, req)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Retry-After", "5")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	if req.URL.Path == "/health" {
+		w.Write([]byte(`{"status":"starting","database":"connecting"}`))
+		return
+	}
+	w.Write([]byte(`{"error":"service is starting"}`))
+}
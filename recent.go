@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// recentHandler serves GET /students/recent?since=<RFC 3339>: students
+// created after since, oldest first, read off the creation time every
+// ObjectID carries so it works on documents that predate created_at. It is
+// a range scan on the _id index. ObjectIDs have one-second resolution, so
+// since is truncated to the second. Students with custom string ids carry
+// no creation time and never appear. ?limit= caps the page as on
+// GET /students; "hasMore" says whether it cut anything off.
+func recentHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		raw := c.Query("since")
+		if raw == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since is required"})
+			return
+		}
+		since, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC 3339 timestamp"})
+			return
+		}
+		limit, _, err := parsePagination(c.Query("limit"), "", cfg.MaxPageSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := dbContext(c, 10*time.Second)
+		defer cancel()
+
+		filter := live(bson.M{"_id": bson.M{"$gt": primitive.NewObjectIDFromTimestamp(since)}})
+		findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(limit + 1)
+		if projection := listProjection(c); projection != nil {
+			findOptions.SetProjection(projection)
+		}
+
+		start := time.Now()
+		cursor, err := coll.Find(ctx, filter, findOptions)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch documents"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		results := []bson.M{}
+		err = cursor.All(ctx, &results)
+		recordDBTime(c, "find", filter, start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to decode documents"})
+			return
+		}
+
+		hasMore := int64(len(results)) > limit
+		if hasMore {
+			results = results[:limit]
+		}
+
+		maskFields(c, results...)
+		respond(c, http.StatusOK, results, gin.H{"since": since.UTC(), "count": len(results), "hasMore": hasMore})
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+// reconnectMu makes overlapping reconnect requests wait their turn.
+var reconnectMu sync.Mutex
+
+// reconnectHandler serves POST /admin/reconnect. It re-reads .env and
+// connects a new client from the current MongoDB settings (MONGODB_URI or
+// its parts, the TLS files and WRITE_CONCERN), and only once that client
+// answers a ping swaps it in for handlers. The old client is then
+// disconnected, giving its in-flight requests up to 30s to finish. If the
+// new client can't connect, the old one is never touched and stays in use.
+func reconnectHandler(c *gin.Context) {
+	reconnectMu.Lock()
+	defer reconnectMu.Unlock()
+
+	if err := godotenv.Overload(); err != nil && !os.IsNotExist(err) {
+		log.Println("Reconnect: failed to read .env:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	next, err := connectMongo(ctx, os.Getenv("WRITE_CONCERN"))
+	if err != nil {
+		log.Println("Reconnect failed, keeping the current MongoDB client:", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status": "failed",
+			"error":  err.Error(),
+			"using":  "previous connection",
+		})
+		return
+	}
+	elapsed := time.Since(start)
+
+	old := liveConn.Swap(next)
+	dbHealthy.Store(true)
+	log.Printf("Reconnected to MongoDB in %s", elapsed.Round(time.Millisecond))
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := old.client.Disconnect(ctx); err != nil {
+			log.Println("Reconnect: old MongoDB client disconnect error:", err)
+		}
+	}()
+
+	recordAudit(c, "reconnect", nil, nil)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "connected",
+		"database":  "up",
+		"connectMs": elapsed.Milliseconds(),
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+// swappableHandler lets a middleware be replaced while requests are in
+// flight.
+type swappableHandler struct {
+	h atomic.Pointer[gin.HandlerFunc]
+}
+
+func (s *swappableHandler) set(h gin.HandlerFunc) { s.h.Store(&h) }
+
+func (s *swappableHandler) handle(c *gin.Context) { (*s.h.Load())(c) }
+
+// reloadOnSIGHUP re-reads the .env file (if any) and the environment on
+// SIGHUP and applies the hot-reloadable settings:
+//
+//   - LOG_LEVEL
+//   - RATE_LIMIT_RPS, RATE_LIMIT_BURST
+//   - CORS_ALLOWED_ORIGINS, CORS_ALLOW_CREDENTIALS
+//
+// Everything else (MongoDB settings, page/batch sizes, timeouts, ...) is
+// read once at startup and needs a restart.
+func reloadOnSIGHUP(limiter *rateLimiter, corsMiddleware *swappableHandler) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+
+	go func() {
+		for range sig {
+			if err := godotenv.Overload(); err != nil && !os.IsNotExist(err) {
+				log.Println("Reload: failed to read .env:", err)
+			}
+
+			logLevel.Store(parseLogLevel(os.Getenv("LOG_LEVEL")))
+			rps, burst := envInt("RATE_LIMIT_RPS", 10), envInt("RATE_LIMIT_BURST", 20)
+			limiter.setLimits(float64(rps), burst)
+
+			// A CORS config that fails validation keeps the previous handler.
+			corsCfg := corsConfig()
+			if h, err := newCORS(corsCfg); err != nil {
+				log.Printf("Reload: invalid CORS config (%v), keeping the previous one", err)
+			} else {
+				corsMiddleware.set(h)
+			}
+
+			log.Printf("Reloaded config: LOG_LEVEL=%q rate=%d/s burst=%d CORS origins=%v",
+				os.Getenv("LOG_LEVEL"), rps, burst, corsCfg.AllowOrigins)
+		}
+	}()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "requestID"
+)
+
+// validRequestID limits which client-supplied ids are trusted, so nothing
+// odd ends up in the logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// requestIDMiddleware tags each request with an id, reusing X-Request-ID when
+// a proxy or client already set a sane one, and echoes it back in the
+// response so logs can be matched to requests.
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			b := make([]byte, 8)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// requestID returns the id assigned by requestIDMiddleware.
+func requestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// isTransientWriteError reports whether err carries a MongoDB label saying
+// the same write may succeed if simply tried again, e.g. after a primary
+// stepdown. Deterministic failures such as duplicate keys are never
+// retried.
+func isTransientWriteError(err error) bool {
+	if mongo.IsDuplicateKeyError(err) {
+		return false
+	}
+	var labeled mongo.LabeledError
+	if !errors.As(err, &labeled) {
+		return false
+	}
+	return labeled.HasErrorLabel("TransientTransactionError") || labeled.HasErrorLabel("RetryableWriteError")
+}
+
+// retryWrite runs write, retrying it up to cfg.WriteRetries more times
+// with doubling backoff from cfg.WriteRetryBackoff while it fails with a
+// transient error. This is on top of the driver's own single retry. Only
+// idempotent writes may be wrapped: a retry can repeat a write whose first
+// attempt actually landed.
+func retryWrite(ctx context.Context, c *gin.Context, op string, write func() error) error {
+	backoff := cfg.WriteRetryBackoff
+	for attempt := int64(1); ; attempt++ {
+		err := write()
+		if err == nil || attempt > cfg.WriteRetries || !isTransientWriteError(err) {
+			return err
+		}
+
+		warnf("request %s: %s failed transiently, retry %d/%d in %s: %v", requestID(c), op, attempt, cfg.WriteRetries, backoff, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
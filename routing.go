@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Values of TRAILING_SLASH.
+const (
+	trailingSlashRedirect = "redirect"
+	trailingSlashMatch    = "match"
+	trailingSlashStrict   = "strict"
+)
+
+// configureRouting applies TRAILING_SLASH and CASE_INSENSITIVE_ROUTES to r
+// and returns the handler to serve it through.
+//
+// TRAILING_SLASH decides what /students/ does:
+//   - "redirect" (the default): redirect to /students, with 301 for GET
+//     and 307 for every other method, so a POST is re-sent with its body
+//   - "match": serve it as /students directly, with no redirect
+//   - "strict": 404
+//
+// CASE_INSENSITIVE_ROUTES=true makes /Students redirect to /students the
+// same way (301 for GET, 307 otherwise), and also fixes up paths such as
+// //students. It corrects the route's fixed segments only; path params
+// such as a name keep the case they were sent in. Gin's path fixing also
+// removes trailing slashes, so "strict" only 404s them while this is off.
+func configureRouting(r *gin.Engine) http.Handler {
+	r.RedirectTrailingSlash = cfg.TrailingSlash == trailingSlashRedirect
+	r.RedirectFixedPath = cfg.CaseInsensitive
+	if cfg.TrailingSlash == trailingSlashMatch {
+		return stripTrailingSlash(r)
+	}
+	return r
+}
+
+// stripTrailingSlash serves /students/ as /students.
+func stripTrailingSlash(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if p := req.URL.Path; len(p) > 1 && strings.HasSuffix(p, "/") {
+			req.URL.Path = strings.TrimRight(p, "/")
+			if req.URL.Path == "" {
+				req.URL.Path = "/"
+			}
+			if req.URL.RawPath != "" {
+				req.URL.RawPath = strings.TrimRight(req.URL.RawPath, "/")
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// schemaSampleSize is how many documents GET /students/schema samples
+// unless ?sample= asks for a different number.
+const schemaSampleSize = 1000
+
+// schemaField is one entry of the GET /students/schema inventory.
+type schemaField struct {
+	Field     string           `json:"field"`
+	Count     int64            `json:"count"`     // sampled documents that have the field
+	Frequency float64          `json:"frequency"` // Count as a fraction of the sample
+	Types     map[string]int64 `json:"types"`     // BSON type name -> documents holding that type
+}
+
+// schemaHandler serves GET /students/schema?sample=: the top-level fields
+// found in a random sample of the collection, each with how often it occurs
+// and how often it holds each BSON type, by $type name ("string", "int",
+// "date", ...). Fields are listed most common first. Nested documents are
+// not descended into, and fields the caller's role may not see are left
+// out.
+func schemaHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		sample := int64(schemaSampleSize)
+		if v := c.Query("sample"); v != "" {
+			var err error
+			if sample, err = intParam("sample", v, 1, cfg.MaxExportPageSize); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		ctx, cancel := dbContext(c, 30*time.Second)
+		defer cancel()
+
+		pipeline := mongo.Pipeline{
+			{{Key: "$sample", Value: bson.D{{Key: "size", Value: sample}}}},
+			{{Key: "$facet", Value: bson.D{
+				{Key: "sampled", Value: bson.A{bson.D{{Key: "$count", Value: "n"}}}},
+				{Key: "fields", Value: bson.A{
+					bson.D{{Key: "$project", Value: bson.D{{Key: "kv", Value: bson.D{{Key: "$objectToArray", Value: "$$ROOT"}}}}}},
+					bson.D{{Key: "$unwind", Value: "$kv"}},
+					bson.D{{Key: "$group", Value: bson.D{
+						{Key: "_id", Value: bson.D{{Key: "field", Value: "$kv.k"}, {Key: "type", Value: bson.D{{Key: "$type", Value: "$kv.v"}}}}},
+						{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+					}}},
+				}},
+			}}},
+		}
+
+		start := time.Now()
+		var result struct {
+			Sampled []struct {
+				N int64 `bson:"n"`
+			} `bson:"sampled"`
+			Fields []struct {
+				ID struct {
+					Field string `bson:"field"`
+					Type  string `bson:"type"`
+				} `bson:"_id"`
+				Count int64 `bson:"count"`
+			} `bson:"fields"`
+		}
+		cursor, err := coll.Aggregate(ctx, pipeline)
+		if err == nil {
+			defer cursor.Close(ctx)
+			if cursor.Next(ctx) {
+				err = cursor.Decode(&result)
+			} else {
+				err = cursor.Err()
+			}
+		}
+		recordDBTime(c, "aggregate", "schema sample", start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to sample documents"})
+			return
+		}
+
+		var sampled int64
+		if len(result.Sampled) > 0 {
+			sampled = result.Sampled[0].N
+		}
+
+		byField := map[string]*schemaField{}
+		for _, f := range result.Fields {
+			if !canSee(c, f.ID.Field) {
+				continue
+			}
+			sf := byField[f.ID.Field]
+			if sf == nil {
+				sf = &schemaField{Field: f.ID.Field, Types: map[string]int64{}}
+				byField[f.ID.Field] = sf
+			}
+			// A field occurs at most once per document, so the per-type
+			// counts add up to the documents having it.
+			sf.Types[f.ID.Type] += f.Count
+			sf.Count += f.Count
+		}
+
+		fields := make([]schemaField, 0, len(byField))
+		for _, sf := range byField {
+			if sampled > 0 {
+				sf.Frequency = float64(sf.Count) / float64(sampled)
+			}
+			fields = append(fields, *sf)
+		}
+		sort.Slice(fields, func(i, j int) bool {
+			if fields[i].Count != fields[j].Count {
+				return fields[i].Count > fields[j].Count
+			}
+			return fields[i].Field < fields[j].Field
+		})
+
+		c.JSON(http.StatusOK, gin.H{"sampled": sampled, "fields": fields})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// headerValues maps response header names to their values.
+type headerValues map[string]string
+
+// defaultSecurityHeaders is the header set SECURITY_HEADERS is merged over. This
+// is a JSON API, so nothing it serves needs to be framed, sniffed or run
+// scripts.
+var defaultSecurityHeaders = headerValues{
+	"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+	"X-Content-Type-Options":    "nosniff",
+	"X-Frame-Options":           "DENY",
+	"Referrer-Policy":           "no-referrer",
+	"Content-Security-Policy":   "default-src 'none'; frame-ancestors 'none'",
+}
+
+// secureMiddleware sets headers on every response and, with FORCE_HTTPS,
+// redirects plain HTTP requests to HTTPS. Strict-Transport-Security is only
+// sent over HTTPS, since browsers ignore it on plain HTTP anyway.
+//
+// TLS is terminated by the proxy in front of the service, so a request
+// counts as plain HTTP only when X-Forwarded-Proto says so; without the
+// header the redirect would loop. /health is never redirected, so the
+// platform's health checks keep working over plain HTTP. The redirect is
+// 301 for GET and HEAD and 308 otherwise, so a POST is re-sent with its
+// body.
+func secureMiddleware(headers headerValues, forceHTTPS bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		proto := strings.ToLower(c.GetHeader("X-Forwarded-Proto"))
+		secure := c.Request.TLS != nil || proto == "https"
+
+		if forceHTTPS && proto == "http" && c.FullPath() != "/health" {
+			status := http.StatusPermanentRedirect
+			if m := c.Request.Method; m == http.MethodGet || m == http.MethodHead {
+				status = http.StatusMovedPermanently
+			}
+			c.Redirect(status, "https://"+c.Request.Host+c.Request.URL.RequestURI())
+			c.Abort()
+			return
+		}
+
+		for name, value := range headers {
+			if name == "Strict-Transport-Security" && !secure {
+				continue
+			}
+			c.Header(name, value)
+		}
+		c.Next()
+	}
+}
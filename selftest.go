@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// runSelfTest round-trips a sentinel document through coll: insert, read
+// back, delete. Each step is logged; the first failure is returned.
+func runSelfTest(coll *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	sentinel := bson.M{
+		"name":       fmt.Sprintf("__selftest__%d", time.Now().UnixNano()),
+		"selftest":   true,
+		"created_at": time.Now().UTC(),
+	}
+
+	res, err := coll.InsertOne(ctx, sentinel)
+	if err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	log.Println("selftest: insert ok")
+
+	var got bson.M
+	if err := coll.FindOne(ctx, bson.M{"_id": res.InsertedID}).Decode(&got); err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	if got["name"] != sentinel["name"] {
+		return fmt.Errorf("read: got name %v, want %v", got["name"], sentinel["name"])
+	}
+	log.Println("selftest: read ok")
+
+	del, err := coll.DeleteOne(ctx, bson.M{"_id": res.InsertedID})
+	if err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	if del.DeletedCount != 1 {
+		return fmt.Errorf("delete: removed %d documents, want 1", del.DeletedCount)
+	}
+	log.Println("selftest: delete ok")
+
+	return nil
+}
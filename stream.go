@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// streamHandler pushes change-stream events for coll to the client as
+// Server-Sent Events. The connection uses its own lifetime rather than any
+// request timeout: it is closed after STREAM_MAX_DURATION, and a comment
+// line is sent every STREAM_HEARTBEAT so proxies don't drop it while idle.
+func streamHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), cfg.StreamMaxDuration)
+		defer cancel()
+
+		opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+		cs, err := coll.Watch(ctx, mongo.Pipeline{}, opts)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to open change stream"})
+			return
+		}
+
+		// The reader goroutine must be done with cs before it is closed:
+		// cancelling ctx ends its Next and its send.
+		events := make(chan bson.M)
+		done := make(chan struct{})
+		defer func() {
+			cancel()
+			<-done
+			cs.Close(context.Background())
+		}()
+		go func() {
+			defer close(done)
+			defer close(events)
+			for cs.Next(ctx) {
+				var event bson.M
+				if err := cs.Decode(&event); err != nil {
+					return
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+
+		heartbeat := time.NewTicker(cfg.StreamHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(c.Writer, ": keep-alive\n\n")
+				c.Writer.Flush()
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if doc, ok := event["fullDocument"].(bson.M); ok {
+					maskFields(c, doc)
+				}
+				renderDocs(c, event["fullDocument"])
+				c.SSEvent("change", gin.H{
+					"operationType": event["operationType"],
+					"documentKey":   event["documentKey"],
+					"fullDocument":  event["fullDocument"],
+				})
+				c.Writer.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxTagLength = 64
+
+// checkTag reports what is wrong with tag, if anything. Tags are free-form
+// but must be non-empty and short enough to index.
+func checkTag(tag string) error {
+	switch {
+	case strings.TrimSpace(tag) == "":
+		return errors.New("tag must not be empty")
+	case len(tag) > maxTagLength:
+		return fmt.Errorf("tag must be at most %d bytes", maxTagLength)
+	}
+	return nil
+}
+
+// tagHandler adds (op "$addToSet") or removes (op "$pull") the :tag path
+// param on a student and answers with the resulting tag list. Adding a tag
+// the student already has, or removing one it lacks, is not an error.
+func tagHandler(coll *mongo.Collection, op string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		id := studentID(c)
+		tag := strings.TrimSpace(c.Param("tag"))
+		if err := checkTag(tag); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := dbContext(c, 5*time.Second)
+		defer cancel()
+
+		update := bson.M{
+			op:     bson.M{"tags": tag},
+			"$set": bson.M{"updated_at": time.Now().UTC()},
+		}
+		opts := options.FindOneAndUpdate().
+			SetReturnDocument(options.After).
+			SetProjection(bson.M{"tags": 1})
+
+		start := time.Now()
+		var doc struct {
+			Tags []string `bson:"tags"`
+		}
+		err := retryWrite(ctx, c, "findOneAndUpdate", func() error {
+			return coll.FindOneAndUpdate(ctx, live(bson.M{"_id": id}), update, opts).Decode(&doc)
+		})
+		recordDBTime(c, "findOneAndUpdate", bson.M{"_id": id}, start)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+			return
+		}
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to update document"})
+			return
+		}
+
+		recordAudit(c, "update", id, bson.M{op: bson.M{"tags": tag}})
+
+		if doc.Tags == nil {
+			doc.Tags = []string{}
+		}
+		c.JSON(http.StatusOK, gin.H{"id": id, "tags": doc.Tags})
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// tenantKey is the context key holding the request's *tenantCollections.
+const tenantKey = "tenant"
+
+// validTenantID keeps tenant ids safe to put in a collection name.
+var validTenantID = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// tenantExempt routes don't touch tenant data and work without a tenant.
+var tenantExempt = map[string]bool{
+	"/health":       true,
+	"/version":      true,
+	"/metrics":      true,
+	"/stats/errors": true,
+}
+
+// tenantCollections are one tenant's students_<id> and alumni_<id> on conn.
+type tenantCollections struct {
+	id       string
+	conn     *mongoConn
+	students *mongo.Collection
+	alumni   *mongo.Collection
+}
+
+// tenantRegistry hands out the collections of the tenants in the TENANTS
+// allowlist. A tenant's collections are created, with their indexes, the
+// first time it is seen, and the handles are cached until the live
+// connection changes.
+type tenantRegistry struct {
+	allowed    map[string]bool
+	createOpts *options.CreateCollectionOptions
+
+	mu      sync.Mutex
+	tenants map[string]*tenantCollections
+}
+
+func newTenantRegistry(allowed []string, createOpts *options.CreateCollectionOptions) *tenantRegistry {
+	reg := &tenantRegistry{
+		allowed:    map[string]bool{},
+		createOpts: createOpts,
+		tenants:    map[string]*tenantCollections{},
+	}
+	for _, id := range allowed {
+		reg.allowed[strings.ToLower(id)] = true
+	}
+	return reg
+}
+
+// get returns the collections of tenant id, setting them up on first use. A
+// failed setup is not cached, so the next request tries again.
+func (reg *tenantRegistry) get(ctx context.Context, id string) (*tenantCollections, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	conn := liveConn.Load()
+	if tc, ok := reg.tenants[id]; ok && tc.conn == conn {
+		return tc, nil
+	}
+
+	if err := ensureCollection(ctx, conn.db, "students_"+id, reg.createOpts); err != nil {
+		return nil, err
+	}
+	tc := &tenantCollections{
+		id:       id,
+		conn:     conn,
+		students: conn.db.Collection("students_"+id, conn.collOpts),
+		alumni:   conn.db.Collection("alumni_" + id),
+	}
+	if err := ensureIndexes(ctx, tc.students); err != nil {
+		return nil, err
+	}
+	reg.tenants[id] = tc
+	return tc, nil
+}
+
+// resolveTenant reads the tenant id from header, or else from the first
+// label of the Host's subdomain (school1.example.com), and attaches that
+// tenant's collections to the request. A missing or malformed id is 400 and
+// one not in the allowlist is 403. tenantExempt routes and unmatched paths
+// pass through untouched.
+func resolveTenant(reg *tenantRegistry, header string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.FullPath()
+		if path == "" || tenantExempt[path] {
+			c.Next()
+			return
+		}
+
+		id := strings.ToLower(strings.TrimSpace(c.GetHeader(header)))
+		if id == "" {
+			id = hostTenant(c.Request.Host)
+		}
+		if id == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "tenant is required (" + header + " header or subdomain)"})
+			return
+		}
+		if !validTenantID.MatchString(id) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid tenant id"})
+			return
+		}
+		if !reg.allowed[id] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "unknown tenant"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		tc, err := reg.get(ctx, id)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to set up tenant collections"})
+			return
+		}
+
+		c.Set(tenantKey, tc)
+		c.Next()
+	}
+}
+
+// hostTenant returns the leftmost label of host when it is a subdomain
+// (at least three labels), or "" otherwise. IP addresses have no tenant.
+func hostTenant(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) < 3 {
+		return ""
+	}
+	return strings.ToLower(labels[0])
+}
+
+// tenantColl returns the request's counterpart of coll, which is one of the
+// handles routes are registered with: the alumni collection for
+// alumniCollection and the students collection for anything else, taken
+// from the request's tenant when there is one and from the live
+// connection otherwise.
+func tenantColl(c *gin.Context, coll *mongo.Collection) *mongo.Collection {
+	alumni := coll == alumniCollection
+	if v, ok := c.Get(tenantKey); ok {
+		tc := v.(*tenantCollections)
+		if alumni {
+			return tc.alumni
+		}
+		return tc.students
+	}
+
+	conn := liveConn.Load()
+	if alumni {
+		return conn.alumni
+	}
+	return conn.students
+}
+
+// requestTenant is the id of the request's tenant, or "" without
+// multi-tenancy.
+func requestTenant(c *gin.Context) string {
+	if v, ok := c.Get(tenantKey); ok {
+		return v.(*tenantCollections).id
+	}
+	return ""
+}
+
+// studentsColl is the students collection of the request's tenant.
+func studentsColl(c *gin.Context) *mongo.Collection {
+	return tenantColl(c, collection)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// textSearchHandler serves GET /students/text-search?q= from the
+// name/email text index, ranked by relevance. Text search differs from
+// GET /students/search: it matches whole words after stemming ("running"
+// finds "run"), ignores stop words and cannot match partial words, whereas
+// the regex search matches any substring.
+//
+// Results fall back to the regex search, reported as "mode": "regex" in the
+// meta, when the collection has no text index or when the caller may not
+// see email: the text index always covers email, so it would let them find
+// students by an address they are not shown.
+func textSearchHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		q := strings.TrimSpace(c.Query("q"))
+		if q == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+			return
+		}
+
+		limit, skip, err := parsePagination(c.Query("limit"), c.Query("skip"), cfg.MaxPageSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := dbContext(c, 10*time.Second)
+		defer cancel()
+
+		mode := "regex"
+		var results []bson.M
+		var total int64
+		if canSee(c, "email") {
+			mode = "text"
+			results, total, err = textSearch(ctx, c, coll, q, limit, skip)
+			if isTextIndexMissing(err) {
+				mode = "regex"
+			}
+		}
+		if mode == "regex" {
+			results, total, err = regexSearch(ctx, c, coll, q, limit, skip)
+		}
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to search documents"})
+			return
+		}
+
+		maskFields(c, results...)
+		c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+		respond(c, http.StatusOK, results, gin.H{"q": q, "mode": mode, "limit": limit, "skip": skip, "count": len(results), "total": total})
+	}
+}
+
+// textSearch runs a $text query sorted by textScore, which is returned on
+// each document as "score".
+func textSearch(ctx context.Context, c *gin.Context, coll *mongo.Collection, q string, limit, skip int64) ([]bson.M, int64, error) {
+	filter := live(bson.M{"$text": bson.M{"$search": q}})
+	score := bson.M{"$meta": "textScore"}
+
+	start := time.Now()
+	defer recordDBTime(c, "find", filter, start)
+
+	total, err := coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: "_id", Value: 1}}).
+		SetLimit(limit).
+		SetSkip(skip)
+	cursor, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	results := []bson.M{}
+	err = cursor.All(ctx, &results)
+	return results, total, err
+}
+
+// regexSearch is the substring search behind GET /students/search.
+func regexSearch(ctx context.Context, c *gin.Context, coll *mongo.Collection, q string, limit, skip int64) ([]bson.M, int64, error) {
+	filter := live(searchFilter(c, q))
+
+	start := time.Now()
+	defer recordDBTime(c, "find", filter, start)
+
+	total, err := coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(limit).
+		SetSkip(skip)
+	cursor, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	results := []bson.M{}
+	err = cursor.All(ctx, &results)
+	return results, total, err
+}
+
+// isTextIndexMissing reports whether err is the server refusing a $text
+// query because the collection has no text index (IndexNotFound).
+func isTextIndexMissing(err error) bool {
+	return hasServerErrorCode(err, 27)
+}
+
+// hasServerErrorCode reports whether err is a server error with any of codes.
+func hasServerErrorCode(err error, codes ...int) bool {
+	var srvErr mongo.ServerError
+	if !errors.As(err, &srvErr) {
+		return false
+	}
+	for _, code := range codes {
+		if srvErr.HasErrorCode(code) {
+			return true
+		}
+	}
+	return false
+}
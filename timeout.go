@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routeTimeoutKey is the context key holding the timeout applyTimeouts
+// resolved for the request.
+const routeTimeoutKey = "routeTimeout"
+
+// routeTimeouts maps Gin route patterns, optionally prefixed with a method
+// ("GET /students/:id"), to the timeout for their database calls.
+type routeTimeouts map[string]time.Duration
+
+// applyTimeouts looks up the matched route in timeouts, first as
+// "METHOD /pattern" and then as the bare pattern, falling back to def
+// (REQUEST_TIMEOUT). Handlers pick the result up through dbContext. A
+// non-zero def replaces the timeout each handler was written with on every
+// route not in timeouts, long-running exports included, so those need their
+// own entries; only with def 0 do unlisted routes keep the handler's own.
+func applyTimeouts(timeouts routeTimeouts, def time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.FullPath()
+		d, ok := timeouts[c.Request.Method+" "+path]
+		if !ok {
+			d, ok = timeouts[path]
+		}
+		if !ok && def > 0 {
+			d, ok = def, true
+		}
+		if ok {
+			c.Set(routeTimeoutKey, d)
+		}
+		c.Next()
+	}
+}
+
+// dbContext returns the context a handler runs its database calls under. It
+// times out after the route's configured timeout, or after def when none is
+// configured. With CANCEL_ON_DISCONNECT it is derived from the request's
+// context, so its deadline is whichever comes first of that timeout and the
+// client going away, and an abandoned request stops its query instead of
+// running it to completion for nobody.
+func dbContext(c *gin.Context, def time.Duration) (context.Context, context.CancelFunc) {
+	if d, ok := c.Get(routeTimeoutKey); ok {
+		def = d.(time.Duration)
+	}
+	parent := context.Background()
+	if cfg.CancelOnDisconnect {
+		parent = c.Request.Context()
+	}
+	return context.WithTimeout(parent, def)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const dbDurationKey = "dbDuration"
+
+// recordDBTime adds the time elapsed since start to the request's running
+// total of time spent waiting on MongoDB, observes it in the /metrics DB
+// duration histogram, and logs the operation when it exceeds SLOW_QUERY_MS.
+func recordDBTime(c *gin.Context, op string, filter interface{}, start time.Time) {
+	elapsed := time.Since(start)
+	c.Set(dbDurationKey, c.GetDuration(dbDurationKey)+elapsed)
+	dbDurations.observe(dbOperationType(op), elapsed)
+
+	if elapsed >= cfg.SlowQueryThreshold {
+		warnf("slow query: %s %s op=%s filter=%v duration=%s",
+			c.Request.Method, c.FullPath(), op, filter, elapsed)
+	}
+}
+
+// debugTiming reports the accumulated DB time in a Server-Timing header when
+// the client sends "X-Debug-Timing: true". It is only installed outside
+// production.
+func debugTiming() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("X-Debug-Timing") == "true" {
+			c.Writer = &timingWriter{ResponseWriter: c.Writer, c: c}
+		}
+		c.Next()
+	}
+}
+
+// timingWriter injects the Server-Timing header just before the response
+// headers are sent, after the handler has finished its DB work.
+type timingWriter struct {
+	gin.ResponseWriter
+	c    *gin.Context
+	done bool
+}
+
+func (w *timingWriter) setHeader() {
+	if w.done {
+		return
+	}
+	w.done = true
+	ms := float64(w.c.GetDuration(dbDurationKey)) / float64(time.Millisecond)
+	w.Header().Set("Server-Timing", fmt.Sprintf("db;dur=%.2f", ms))
+}
+
+func (w *timingWriter) WriteHeader(code int) {
+	w.setHeader()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *timingWriter) WriteHeaderNow() {
+	w.setHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *timingWriter) Write(data []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timingWriter) WriteString(s string) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// tombstonesCollection remembers the students removed outright rather than
+// soft-deleted, by archive and merge, as {collection, student_id,
+// deleted_at}. GET /students/changes reports them like soft deletes, and
+// the purge drops them after SOFT_DELETE_RETENTION along with the
+// soft-deleted students themselves.
+const tombstonesCollection = "tombstones"
+
+// buryStudents records that ids were removed from coll at now. Pass the
+// session context of the transaction that deletes them, so the tombstones
+// exist exactly when the deletes do.
+func buryStudents(ctx context.Context, coll *mongo.Collection, ids []interface{}, now time.Time) error {
+	docs := make([]interface{}, len(ids))
+	for i, id := range ids {
+		docs[i] = bson.M{"collection": coll.Name(), "student_id": id, softDeletedKey: now}
+	}
+	_, err := coll.Database().Collection(tombstonesCollection).InsertMany(ctx, docs)
+	return err
+}
+
+// tombstoneStage adds coll's tombstones from since on to a changes
+// pipeline, shaped like soft-deleted students: the student's _id,
+// deleted_at and _changed_at.
+func tombstoneStage(coll *mongo.Collection, since time.Time) bson.D {
+	return bson.D{{Key: "$unionWith", Value: bson.M{
+		"coll": tombstonesCollection,
+		"pipeline": bson.A{
+			bson.M{"$match": bson.M{"collection": coll.Name(), softDeletedKey: bson.M{"$gte": since}}},
+			bson.M{"$project": bson.M{"_id": "$student_id", softDeletedKey: 1, "_changed_at": "$" + softDeletedKey}},
+		},
+	}}}
+}
+
+// ensureTombstoneIndexes backs the per-collection lookups of the changes
+// feed and the purge.
+func ensureTombstoneIndexes(ctx context.Context, coll *mongo.Collection) error {
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "collection", Value: 1}, {Key: softDeletedKey, Value: 1}},
+		Options: options.Index().SetName("collection_1_deleted_at_1"),
+	})
+	return err
+}
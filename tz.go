@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"time"
+	_ "time/tzdata" // ?tz= must not depend on the host having a zoneinfo database
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// locationKey is the context key holding the *time.Location from ?tz=.
+const locationKey = "location"
+
+// parseTimezone reads ?tz=, an IANA zone name such as America/New_York,
+// for every route and aborts with 400 when it is not a known zone. Without
+// the param responses stay in UTC. "Local" is rejected too: it is the
+// server's zone, which clients can't know.
+func parseTimezone() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name, ok := c.GetQuery("tz")
+		if !ok {
+			c.Next()
+			return
+		}
+		loc, err := time.LoadLocation(name)
+		if err != nil || name == "" || name == "Local" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "tz must be an IANA time zone name such as America/New_York"})
+			return
+		}
+		c.Set(locationKey, loc)
+		c.Next()
+	}
+}
+
+// requestLocation is the zone timestamps are rendered in, UTC unless the
+// request set ?tz=.
+func requestLocation(c *gin.Context) *time.Location {
+	if loc, ok := c.Get(locationKey); ok {
+		return loc.(*time.Location)
+	}
+	return time.UTC
+}
+
+// localizedFields are the timestamps ?tz= converts.
+var localizedFields = []string{"created_at", "updated_at"}
+
+// localizeTimes rewrites the localizedFields of the documents in data, in
+// place, as times in loc, so they render with loc's offset, e.g.
+// "2024-05-01T08:00:00-04:00".
+func localizeTimes(data interface{}, loc *time.Location) {
+	eachDoc(data, func(doc map[string]interface{}) {
+		for _, key := range localizedFields {
+			switch t := doc[key].(type) {
+			case primitive.DateTime:
+				doc[key] = t.Time().In(loc)
+			case time.Time:
+				doc[key] = t.In(loc)
+			}
+		}
+	})
+}
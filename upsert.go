@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// upsertHandler serves POST /students/upsert for syncing from an external
+// system: a JSON array of students, each matched to a stored student by
+// email, which every item must have. Items are checked like POST /students
+// bodies; one that fails, or whose student someone else has locked (with
+// HONOR_LOCKS), is reported and not sent. A match gets just the fields the
+// item supplies set; no match inserts the item as a new student. Only
+// inserts need a name, so an item without one fails unless its email
+// matches. The items go to MongoDB as one unordered bulkWrite, so one bad
+// item doesn't stop the rest. The unique email index makes concurrent
+// syncs of the same email agree on a single student.
+//
+// The response counts items inserted, updated (matched) and failed, and
+// gives each item's outcome in "results", with the student number of each
+// inserted student. Every student inserted or updated gets its own audit
+// entry.
+func upsertHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		var items []json.RawMessage
+		if err := bindJSON(c, &items); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(items) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No students provided"})
+			return
+		}
+		if int64(len(items)) > cfg.MaxBatchSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d students per request", cfg.MaxBatchSize)})
+			return
+		}
+
+		students := make([]Student, len(items))
+		supplied := make([]map[string]json.RawMessage, len(items))
+		failed := map[int]string{}
+		nameless := map[int]bool{}
+		var valid []int
+		var emails, namelessEmails bson.A
+		for i, raw := range items {
+			s := &students[i]
+			if err := decodeJSON(raw, s); err != nil {
+				failed[i] = err.Error()
+				continue
+			}
+			if err := decodeJSON(raw, &supplied[i]); err != nil {
+				failed[i] = err.Error()
+				continue
+			}
+			s.Email = strings.TrimSpace(s.Email)
+			if s.Email == "" {
+				failed[i] = "email is required"
+				continue
+			}
+			problems := checkStudentFields(*s)
+			if strings.TrimSpace(s.Name) == "" && !suppliesField(supplied[i], "name") {
+				// Whether the item may go without a name is only known
+				// once its email has been looked up.
+				nameless[i] = true
+				problems = slices.DeleteFunc(problems, func(p string) bool { return p == checkName("") })
+			}
+			if len(problems) > 0 {
+				failed[i] = strings.Join(problems, "; ")
+				continue
+			}
+			valid = append(valid, i)
+			emails = append(emails, s.Email)
+			if nameless[i] {
+				namelessEmails = append(namelessEmails, s.Email)
+			}
+		}
+
+		ctx, cancel := dbContext(c, 30*time.Second)
+		defer cancel()
+
+		// A locked student must not be matched, but with writable leaving
+		// it out of the filter the item would try to insert a second
+		// student with its email, so such items are refused up front.
+		lockedByEmail := map[string]studentLock{}
+		if len(emails) > 0 {
+			locked, err := findLocked(ctx, c, coll, bson.M{"email": bson.M{"$in": emails}})
+			if err != nil {
+				dbError(c, err, gin.H{"error": "Failed to check locks"})
+				return
+			}
+			for _, doc := range locked {
+				if email, ok := doc["email"].(string); ok {
+					lockedByEmail[email] = docLock(doc)
+				}
+			}
+		}
+
+		stored := map[string]bool{}
+		if len(namelessEmails) > 0 {
+			start := time.Now()
+			filter := live(bson.M{"email": bson.M{"$in": namelessEmails}})
+			var docs []struct {
+				Email string `bson:"email"`
+			}
+			cursor, err := coll.Find(ctx, filter, options.Find().SetProjection(bson.M{"email": 1}))
+			if err == nil {
+				err = cursor.All(ctx, &docs)
+			}
+			recordDBTime(c, "find", filter, start)
+			if err != nil {
+				dbError(c, err, gin.H{"error": "Failed to fetch documents"})
+				return
+			}
+			for _, d := range docs {
+				stored[d.Email] = true
+			}
+		}
+
+		now := time.Now().UTC()
+		var models []mongo.WriteModel
+		var sent []int // item index of each model
+		updates := map[int]bson.M{}
+		for _, i := range valid {
+			s := &students[i]
+			if l, ok := lockedByEmail[s.Email]; ok {
+				failed[i] = errLocked{l}.Error()
+				continue
+			}
+			if nameless[i] && !stored[s.Email] {
+				failed[i] = "name is required to insert a new student"
+				continue
+			}
+			updates[i] = upsertUpdate(s, supplied[i], now)
+			// Without a name the item must not insert, even should its
+			// match be deleted meanwhile.
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(writable(c, bson.M{"email": s.Email})).
+				SetUpdate(updates[i]).
+				SetUpsert(!nameless[i]))
+			sent = append(sent, i)
+		}
+
+		result := &mongo.BulkWriteResult{}
+		upserted := map[int64]interface{}{}
+		if len(models) > 0 {
+			start := time.Now()
+			res, err := coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+			recordDBTime(c, "bulkWrite", "upsert by email", start)
+
+			var bulkErr mongo.BulkWriteException
+			if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+				for _, we := range bulkErr.WriteErrors {
+					failed[sent[we.Index]] = we.Message
+				}
+			} else if err != nil {
+				dbError(c, err, gin.H{"error": "Failed to upsert documents"})
+				return
+			}
+			if res != nil {
+				result = res
+			}
+			for k, id := range result.UpsertedIDs {
+				upserted[int64(sent[k])] = id
+			}
+		}
+
+		numbers := numberUpserted(ctx, c, coll, upserted)
+
+		results := make([]gin.H, len(students))
+		for i := range students {
+			if msg, ok := failed[i]; ok {
+				results[i] = gin.H{"index": i, "email": students[i].Email, "status": "failed", "error": msg}
+			} else if id, ok := upserted[int64(i)]; ok {
+				results[i] = gin.H{"index": i, "email": students[i].Email, "status": "inserted", "insertedID": id}
+				if n, ok := numbers[int64(i)]; ok {
+					results[i]["studentNumber"] = n
+				}
+			} else {
+				results[i] = gin.H{"index": i, "email": students[i].Email, "status": "updated"}
+			}
+		}
+
+		auditUpserted(ctx, c, coll, students, sent, failed, upserted, updates)
+
+		status := http.StatusOK
+		if len(failed) > 0 {
+			status = http.StatusMultiStatus
+		}
+		c.JSON(status, gin.H{
+			"inserted": result.UpsertedCount,
+			"updated":  result.MatchedCount,
+			"failed":   len(failed),
+			"results":  results,
+		})
+	}
+}
+
+// auditUpserted records a "create" entry for each student the upsert
+// inserted and an "update" entry, with the fields set or unset, for each it
+// matched. Matched items only carry their email, so the ids are looked up
+// by it; should that fail, the entries are still written, without an id.
+func auditUpserted(ctx context.Context, c *gin.Context, coll *mongo.Collection, students []Student, sent []int, failed map[int]string, upserted map[int64]interface{}, updates map[int]bson.M) {
+	var emails bson.A
+	for _, i := range sent {
+		if _, ok := upserted[int64(i)]; !ok && failed[i] == "" {
+			emails = append(emails, students[i].Email)
+		}
+	}
+
+	idByEmail := map[string]interface{}{}
+	if len(emails) > 0 {
+		start := time.Now()
+		filter := bson.M{"email": bson.M{"$in": emails}}
+		var docs []struct {
+			ID    interface{} `bson:"_id"`
+			Email string      `bson:"email"`
+		}
+		cursor, err := coll.Find(ctx, live(filter), options.Find().SetProjection(bson.M{"_id": 1, "email": 1}))
+		if err == nil {
+			err = cursor.All(ctx, &docs)
+		}
+		recordDBTime(c, "find", filter, start)
+		if err != nil {
+			warnf("request %s: failed to look up upserted students for the audit log: %v", requestID(c), err)
+		}
+		for _, d := range docs {
+			idByEmail[d.Email] = d.ID
+		}
+	}
+
+	for _, i := range sent {
+		s := &students[i]
+		if id, ok := upserted[int64(i)]; ok {
+			recordAudit(c, "create", id, bson.M{"name": s.Name, "age": s.Age, "email": s.Email})
+			continue
+		}
+		if failed[i] != "" {
+			continue
+		}
+		changes := bson.M{"email": s.Email}
+		for k, v := range updates[i]["$set"].(bson.M) {
+			if k != "updated_at" {
+				changes[k] = v
+			}
+		}
+		if unset, ok := updates[i]["$unset"].(bson.M); ok {
+			for k := range unset {
+				changes[k] = nil
+			}
+		}
+		recordAudit(c, "update", idByEmail[s.Email], changes)
+	}
+}
+
+// numberUpserted gives the students inserted by an upsert, keyed by item
+// index, their student numbers. Numbers reserved up front for $setOnInsert
+// would be used up by every matched item too, so this is a second write.
+// It returns the numbers assigned; a failure is logged and leaves those
+// students to POST /students/:id/number.
+func numberUpserted(ctx context.Context, c *gin.Context, coll *mongo.Collection, ids map[int64]interface{}) map[int64]int64 {
+	if len(ids) == 0 {
+		return nil
+	}
+	indexes := make([]int64, 0, len(ids))
+	for i := range ids {
+		indexes = append(indexes, i)
+	}
+	slices.Sort(indexes)
+
+	start := time.Now()
+	first, err := reserveStudentNumbers(ctx, coll, len(indexes))
+	recordDBTime(c, "findOneAndUpdate", "next student numbers", start)
+	if err != nil {
+		log.Printf("Failed to number upserted students: %v", err)
+		return nil
+	}
+
+	numbers := map[int64]int64{}
+	models := make([]mongo.WriteModel, len(indexes))
+	for k, i := range indexes {
+		numbers[i] = first + int64(k)
+		models[k] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": ids[i], "student_number": bson.M{"$exists": false}}).
+			SetUpdate(bson.M{"$set": bson.M{"student_number": numbers[i]}})
+	}
+
+	start = time.Now()
+	_, err = coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	recordDBTime(c, "bulkWrite", "number upserted", start)
+	if err != nil {
+		log.Printf("Failed to number upserted students: %v", err)
+		return nil
+	}
+	return numbers
+}
+
+// upsertFields are the stored fields an upsert item may set on a matched
+// student. The rest of insertDoc is server-managed, and email is the key.
+var upsertFields = map[string]bool{
+	"name": true, "age": true, "courses": true, "position": true, "active": true, "tags": true,
+}
+
+// suppliesField reports whether an upsert item gives the stored field a
+// value; null counts as absent.
+func suppliesField(supplied map[string]json.RawMessage, field string) bool {
+	for k, v := range supplied {
+		if storedName(k) == field && string(v) != "null" {
+			return true
+		}
+	}
+	return false
+}
+
+// upsertUpdate builds the update for one upserted student: a $set of the
+// fields the item supplied (the keys of supplied, null counting as absent)
+// plus updated_at, and a $setOnInsert of the rest of the new student's
+// document, so a match keeps the fields the item left out and an insert
+// gets the defaults POST /students would give it. A supplied optional field
+// that is empty is unset, as insertDoc leaves such fields out. The _id of
+// an inserted student is chosen by the server, and email comes from the
+// filter.
+func upsertUpdate(s *Student, supplied map[string]json.RawMessage, now time.Time) bson.M {
+	given := map[string]bool{}
+	for k, v := range supplied {
+		if field := storedName(k); upsertFields[field] && string(v) != "null" {
+			given[field] = true
+		}
+	}
+
+	s.prepareInsert(now)
+	set := bson.M{"updated_at": now}
+	onInsert := bson.M{}
+	for _, e := range s.insertDoc() {
+		switch {
+		case e.Key == "_id", e.Key == "email", e.Key == "updated_at":
+		case given[e.Key]:
+			set[e.Key] = e.Value
+			delete(given, e.Key)
+		default:
+			onInsert[e.Key] = e.Value
+		}
+	}
+
+	update := bson.M{"$set": set}
+	if len(onInsert) > 0 {
+		update["$setOnInsert"] = onInsert
+	}
+	if len(given) > 0 {
+		unset := bson.M{}
+		for field := range given {
+			unset[field] = ""
+		}
+		update["$unset"] = unset
+	}
+	return update
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const maxAge = 150
+
+// checkStudentFields applies the per-document rules enforced on create,
+// without touching the database.
+func checkStudentFields(s Student) []string {
+	var problems []string
+
+	if msg := checkName(s.Name); msg != "" {
+		problems = append(problems, msg)
+	}
+	if msg := checkAge(s.Age); msg != "" {
+		problems = append(problems, msg)
+	}
+	if s.Email != "" {
+		if msg := checkEmail(s.Email); msg != "" {
+			problems = append(problems, msg)
+		}
+	}
+	for _, tag := range s.Tags {
+		if err := checkTag(tag); err != nil {
+			problems = append(problems, err.Error())
+			break
+		}
+	}
+
+	return problems
+}
+
+// checkUpdateFields applies the checkStudentFields rules to the fields u
+// sets, so PATCH can't store what POST would reject. An email can't be set
+// to "": an optional field is removed with ?unset= instead.
+func checkUpdateFields(u StudentUpdate) []string {
+	var problems []string
+
+	if u.Name != nil {
+		if msg := checkName(*u.Name); msg != "" {
+			problems = append(problems, msg)
+		}
+	}
+	if u.Age != nil {
+		if msg := checkAge(*u.Age); msg != "" {
+			problems = append(problems, msg)
+		}
+	}
+	if u.Email != nil {
+		if msg := checkEmail(*u.Email); msg != "" {
+			problems = append(problems, msg)
+		}
+	}
+
+	return problems
+}
+
+func checkName(name string) string {
+	if strings.TrimSpace(name) == "" {
+		return "name is required"
+	}
+	return ""
+}
+
+func checkAge(age Age) string {
+	if age < 0 || age > maxAge {
+		return fmt.Sprintf("age must be between 0 and %d", maxAge)
+	}
+	return ""
+}
+
+func checkEmail(email string) string {
+	if _, err := mail.ParseAddress(email); err != nil {
+		return "email is not a valid address"
+	}
+	return ""
+}
+
+// validateStudent checks s against the rules enforced on create, including
+// that no existing student already uses the same name or email. It returns
+// one message per violation; a non-nil error means the checks themselves
+// could not run.
+func validateStudent(ctx context.Context, coll *mongo.Collection, s Student) ([]string, error) {
+	problems := checkStudentFields(s)
+
+	if s.Name != "" {
+		// Same collation as the unique index, so "john" clashes with "John".
+		n, err := coll.CountDocuments(ctx, bson.M{"name": s.Name}, options.Count().SetCollation(nameCollation))
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			problems = append(problems, "name is already taken")
+		}
+	}
+	if s.Email != "" {
+		n, err := coll.CountDocuments(ctx, bson.M{"email": s.Email})
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			problems = append(problems, "email is already taken")
+		}
+	}
+
+	return problems, nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Build metadata, set at link time, e.g.
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+// versionHandler serves GET /version so a deploy can be checked against the
+// build it was meant to ship.
+func versionHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"version":   version,
+		"commit":    commit,
+		"buildTime": buildTime,
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// parseWriteConcern accepts "majority" or a node count of at least 1. An empty
+// string means "use the server/URI default" and returns nil.
+func parseWriteConcern(v string) (*writeconcern.WriteConcern, error) {
+	switch v {
+	case "":
+		return nil, nil
+	case "majority":
+		return writeconcern.Majority(), nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid write concern %q", v)
+	}
+	return &writeconcern.WriteConcern{W: n}, nil
+}
+
+// fastWrites returns coll with a w:1 write concern when the request asks for
+// ?fastWrite=true. Writes are then acknowledged by the primary alone, so a
+// failover right after the response can lose them; only use it for bulk
+// imports that can be re-run.
+func fastWrites(coll *mongo.Collection, fast bool) *mongo.Collection {
+	if !fast {
+		return coll
+	}
+	clone, err := coll.Clone(options.Collection().SetWriteConcern(writeconcern.W1()))
+	if err != nil {
+		return coll
+	}
+	return clone
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	mimeXLSX  = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	xlsxSheet = "Students"
+)
+
+// exportXLSXHandler serves the roster as an Excel workbook. It takes the same
+// filter, sort, ?columns= and ?skip= / ?limit= params as the CSV export.
+// Cells are typed: ages stay numbers, timestamps are Excel dates and active
+// is a boolean, so the sheet sorts and filters properly once opened. The
+// workbook is built before anything is sent, so a failed fetch is still a
+// JSON error rather than a truncated file.
+func exportXLSXHandler(coll *mongo.Collection) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coll := tenantColl(c, coll)
+
+		ctx, cancel := dbContext(c, 2*time.Minute)
+		defer cancel()
+
+		limit, skip, err := parsePagination(c.Query("limit"), c.Query("skip"), cfg.MaxExportPageSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		filter, err := parseFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		cols, err := parseCSVColumns(c.Query("columns"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sort, err := effectiveSort(c.Query("sort"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		projection := bson.M{}
+		for _, col := range cols {
+			projection[col] = 1
+		}
+		findOptions := options.Find().SetLimit(limit).SetSkip(skip).SetProjection(projection).SetSort(sort)
+
+		start := time.Now()
+		total, err := coll.CountDocuments(ctx, filter)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to count documents"})
+			return
+		}
+
+		cursor, err := coll.Find(ctx, filter, findOptions)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to fetch documents"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		f := excelize.NewFile()
+		defer f.Close()
+		_, err = writeXLSXSheet(ctx, c, f, cursor, cols)
+		recordDBTime(c, "find", filter, start)
+		if err != nil {
+			dbError(c, err, gin.H{"error": "Failed to build spreadsheet"})
+			return
+		}
+
+		c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+		c.Header("Content-Type", mimeXLSX)
+		c.Header("Content-Disposition", `attachment; filename="students.xlsx"`)
+		c.Status(http.StatusOK)
+		f.Write(c.Writer)
+	}
+}
+
+// writeXLSXSheet fills the workbook's only sheet with a bold header row and
+// one row per document in cursor, returning the number of documents written.
+func writeXLSXSheet(ctx context.Context, c *gin.Context, f *excelize.File, cursor *mongo.Cursor, cols []string) (int, error) {
+	if err := f.SetSheetName("Sheet1", xlsxSheet); err != nil {
+		return 0, err
+	}
+	sw, err := f.NewStreamWriter(xlsxSheet)
+	if err != nil {
+		return 0, err
+	}
+
+	bold, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return 0, err
+	}
+	dateFmt := "yyyy-mm-dd hh:mm:ss"
+	date, err := f.NewStyle(&excelize.Style{CustomNumFmt: &dateFmt})
+	if err != nil {
+		return 0, err
+	}
+
+	for i, col := range cols {
+		width := 12.0
+		switch col {
+		case "_id", "created_at", "updated_at":
+			width = 24
+		case "name", "email":
+			width = 30
+		}
+		if err := sw.SetColWidth(i+1, i+1, width); err != nil {
+			return 0, err
+		}
+	}
+
+	header := make([]interface{}, len(cols))
+	for i, col := range cols {
+		header[i] = excelize.Cell{StyleID: bold, Value: col}
+	}
+	// Keep the header in view while scrolling.
+	if err := sw.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		return 0, err
+	}
+	if err := sw.SetRow("A1", header); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return 0, err
+		}
+		maskFields(c, doc)
+
+		row := make([]interface{}, len(cols))
+		for i, col := range cols {
+			row[i] = xlsxValue(doc[col], date)
+		}
+		cell, err := excelize.CoordinatesToCellName(1, n+2)
+		if err != nil {
+			return 0, err
+		}
+		if err := sw.SetRow(cell, row); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	if err := cursor.Err(); err != nil {
+		return 0, err
+	}
+	return n, sw.Flush()
+}
+
+// xlsxValue converts a decoded BSON value to a typed cell. Numbers and
+// booleans pass through; dates get the date style.
+func xlsxValue(v interface{}, dateStyle int) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case int32, int64, float64, bool, string:
+		return v
+	case primitive.DateTime:
+		return excelize.Cell{StyleID: dateStyle, Value: v.Time().UTC()}
+	}
+	return csvValue(v)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/xml"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// studentList is the XML root for list responses.
+type studentList struct {
+	XMLName  xml.Name  `xml:"students"`
+	Students []Student `xml:"student"`
+}
+
+// toStudent converts a stored document into a Student for XML rendering,
+// with its timestamps in loc. Fields already removed by maskFields stay
+// empty.
+func toStudent(doc bson.M, loc *time.Location) Student {
+	var s Student
+	if raw, err := bson.Marshal(doc); err == nil {
+		bson.Unmarshal(raw, &s)
+	}
+	if !s.CreatedAt.IsZero() {
+		s.CreatedAt = s.CreatedAt.In(loc)
+	}
+	if !s.UpdatedAt.IsZero() {
+		s.UpdatedAt = s.UpdatedAt.In(loc)
+	}
+	return s
+}
+
+func toStudentList(docs []bson.M, loc *time.Location) studentList {
+	list := studentList{Students: make([]Student, len(docs))}
+	for i, doc := range docs {
+		list.Students[i] = toStudent(doc, loc)
+	}
+	return list
+}
+
+// respondItem writes a single student as XML or (possibly enveloped) JSON,
+// depending on the negotiated format.
+func respondItem(c *gin.Context, status int, doc bson.M) {
+	if responseFormat(c) == mimeXML {
+		c.XML(status, toStudent(doc, requestLocation(c)))
+		return
+	}
+	respond(c, status, doc, nil)
+}